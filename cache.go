@@ -0,0 +1,325 @@
+package policyauthor
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"reflect"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/raphaelreyna/policyauthor/pkg/maputils"
+)
+
+// CacheStats describes the activity of a decision cache.
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+	// Entries is the number of decisions currently cached.
+	Entries int
+	// CacheablePolicies is the number of leading policies whose decisions are cached.
+	// Evaluation of the policies after them is never cached.
+	CacheablePolicies int
+	// Keys are the evaluation context keys decisions are fingerprinted by.
+	Keys []string
+}
+
+type cacheEntry struct {
+	fingerprint [sha256.Size]byte
+	decision    decision
+	expires     time.Time
+}
+
+// decisionCache is an LRU cache of the decisions of the leading cacheable policies of an engine.
+type decisionCache struct {
+	size int
+	ttl  time.Duration
+
+	// prefix is the number of leading policies whose decisions are cached.
+	prefix int
+	// keys are the sorted keys read by the cached policies. When wholeContext is set, every key is fingerprinted.
+	keys         []string
+	wholeContext bool
+	// valueKeys are the sorted valueFrom keys of the cached policies, which are read as top-level keys.
+	valueKeys []string
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]*list.Element
+	lru     *list.List
+
+	hits, misses atomic.Uint64
+}
+
+func newDecisionCache(size int, ttl time.Duration, policies []*Policy) *decisionCache {
+	c := &decisionCache{
+		size:    size,
+		ttl:     ttl,
+		entries: map[[sha256.Size]byte]*list.Element{},
+		lru:     list.New(),
+	}
+
+	keys := map[string]struct{}{}
+	valueKeys := map[string]struct{}{}
+	for _, p := range policies {
+		pk, ok := p.cacheKeys()
+		if !ok {
+			break
+		}
+		if p.ValueFrom != "" {
+			valueKeys[p.ValueFrom] = struct{}{}
+		}
+		for _, k := range pk {
+			if k == "" {
+				c.wholeContext = true
+			}
+			keys[k] = struct{}{}
+		}
+		c.prefix++
+	}
+
+	for k := range keys {
+		c.keys = append(c.keys, k)
+	}
+	sort.Strings(c.keys)
+	for k := range valueKeys {
+		c.valueKeys = append(c.valueKeys, k)
+	}
+	sort.Strings(c.valueKeys)
+
+	return c
+}
+
+// cacheKeys returns the keys the policy reads, or false if its decisions cannot be cached.
+func (p *Policy) cacheKeys() ([]string, bool) {
+	if len(p.Values) > 0 && len(p.StickyBy) == 0 {
+		// Random selection.
+		return nil, false
+	}
+
+	keys, ok := p.contextKeys()
+	if !ok {
+		return nil, false
+	}
+
+	for _, c := range p.Conditions {
+		Walk(c, func(c *Condition) bool {
+			if v, isVolatile := c.Spec.(Volatile); isVolatile && v.Volatile() {
+				ok = false
+			}
+			return ok
+		})
+	}
+
+	return keys, ok
+}
+
+// fingerprint hashes the values at the cached keys of evaluationContext.
+// It returns false if a value cannot be fingerprinted.
+func (c *decisionCache) fingerprint(evaluationContext map[string]any) ([sha256.Size]byte, bool) {
+	var sum [sha256.Size]byte
+
+	h := sha256.New()
+	if c.wholeContext {
+		if !writeFingerprint(h, evaluationContext) {
+			return sum, false
+		}
+	} else {
+		for _, k := range c.keys {
+			val, found := maputils.RecursiveGet(k, evaluationContext)
+			if !writeKeyFingerprint(h, k, val, found) {
+				return sum, false
+			}
+		}
+		for _, k := range c.valueKeys {
+			val, found := evaluationContext[k]
+			if !writeKeyFingerprint(h, k, val, found) {
+				return sum, false
+			}
+		}
+	}
+
+	h.Sum(sum[:0])
+	return sum, true
+}
+
+func (c *decisionCache) get(fp [sha256.Size]byte, now time.Time) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[fp]
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	entry := e.Value.(*cacheEntry)
+	if c.ttl > 0 && !now.Before(entry.expires) {
+		c.lru.Remove(e)
+		delete(c.entries, fp)
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	c.lru.MoveToFront(e)
+	c.hits.Add(1)
+	return entry, true
+}
+
+func (c *decisionCache) put(fp [sha256.Size]byte, d decision, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &cacheEntry{fingerprint: fp, decision: d, expires: now.Add(c.ttl)}
+	if e, ok := c.entries[fp]; ok {
+		e.Value = entry
+		c.lru.MoveToFront(e)
+		return
+	}
+
+	if c.lru.Len() >= c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).fingerprint)
+	}
+	c.entries[fp] = c.lru.PushFront(entry)
+}
+
+func (c *decisionCache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{
+		Hits:              c.hits.Load(),
+		Misses:            c.misses.Load(),
+		Entries:           c.lru.Len(),
+		CacheablePolicies: c.prefix,
+		Keys:              slices.Clone(c.keys),
+	}
+}
+
+// writeKeyFingerprint writes key and the value found at key, if any, to h.
+func writeKeyFingerprint(h hash.Hash, key string, val any, found bool) bool {
+	writeString(h, key)
+	if !found {
+		h.Write([]byte{0})
+		return true
+	}
+	h.Write([]byte{1})
+	return writeFingerprint(h, val)
+}
+
+func writeString(h hash.Hash, s string) {
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], uint64(len(s)))
+	h.Write(n[:])
+	h.Write([]byte(s))
+}
+
+// writeFingerprint writes an unambiguous encoding of val, including its type, to h.
+// Only scalars, times, and maps with string keys and lists of those can be fingerprinted.
+func writeFingerprint(h hash.Hash, val any) bool {
+	switch v := val.(type) {
+	case nil:
+		h.Write([]byte{'n'})
+		return true
+	case string:
+		h.Write([]byte{'s'})
+		writeString(h, v)
+		return true
+	case time.Time:
+		b, err := v.MarshalBinary()
+		if err != nil {
+			return false
+		}
+		h.Write([]byte{'t'})
+		writeString(h, string(b))
+		return true
+	}
+
+	rv := reflect.ValueOf(val)
+	switch rv.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.String:
+		h.Write([]byte{'v'})
+		writeString(h, fmt.Sprintf("%T=%v", val, val))
+		return true
+	case reflect.Slice, reflect.Array:
+		h.Write([]byte{'l'})
+		writeString(h, rv.Type().String())
+		writeString(h, fmt.Sprint(rv.Len()))
+		for i := 0; i < rv.Len(); i++ {
+			if !writeFingerprint(h, rv.Index(i).Interface()) {
+				return false
+			}
+		}
+		return true
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return false
+		}
+		h.Write([]byte{'m'})
+		writeString(h, rv.Type().String())
+
+		keys := make([]string, 0, rv.Len())
+		for _, k := range rv.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+
+		writeString(h, fmt.Sprint(len(keys)))
+		for _, k := range keys {
+			writeString(h, k)
+			if !writeFingerprint(h, rv.MapIndex(reflect.ValueOf(k).Convert(rv.Type().Key())).Interface()) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// copyValue returns a copy of val sharing none of its maps and slices, so that cached values cannot be modified by callers.
+func copyValue(val any) any {
+	if val == nil {
+		return nil
+	}
+	return copyReflect(reflect.ValueOf(val)).Interface()
+}
+
+func copyReflect(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type()).Elem()
+		out.Set(copyReflect(v.Elem()))
+		return out
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		m := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for it := v.MapRange(); it.Next(); {
+			m.SetMapIndex(it.Key(), copyReflect(it.Value()))
+		}
+		return m
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		s := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			s.Index(i).Set(copyReflect(v.Index(i)))
+		}
+		return s
+	}
+	return v
+}
@@ -0,0 +1,22 @@
+package policyauthor
+
+import "time"
+
+// Clock is the source of the current time for conditions that depend on it.
+type Clock interface {
+	Now() time.Time
+}
+
+type ClockFunc func() time.Time
+
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// SystemClock reports the current wall clock time.
+var SystemClock Clock = ClockFunc(time.Now)
+
+// ClockUser is implemented by condition specs that read the current time.
+type ClockUser interface {
+	SetClock(c Clock)
+}
@@ -0,0 +1,316 @@
+// Command policyauthor provides tooling for policy files.
+//
+// Usage:
+//
+//	policyauthor diff [flags] old.yaml new.yaml --corpus requests.jsonl
+//	policyauthor coverage [flags] policies.yaml --corpus requests.jsonl [--html coverage.html]
+//	policyauthor lint [flags] policies.yaml
+//
+// diff replays the evaluation contexts of a corpus, one JSON object per line, against two versions of a policy file
+// and reports the contexts whose outcome changed, grouped by transition. It exits with status 0 when no outcome
+// changed, 1 when some did, and 2 on errors.
+//
+// coverage evaluates the contexts of a corpus against a policy file and reports, for every policy and condition,
+// how many times it evaluated true, false or failed, and which were never reached.
+//
+// lint reports the policies of a policy file that can never match, either because their conditions contradict
+// themselves or because earlier policies shadow them. It exits with status 1 when it reports any.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/raphaelreyna/policyauthor"
+	"github.com/raphaelreyna/policyauthor/pkg/conditions"
+	"github.com/raphaelreyna/policyauthor/pkg/replay"
+	"gopkg.in/yaml.v3"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintln(stderr, diffUsage)
+		fmt.Fprintln(stderr, coverageUsage)
+		fmt.Fprintln(stderr, lintUsage)
+		return 2
+	}
+
+	policyauthor.RegisterConditions(conditions.AllConditionsMap())
+
+	switch args[0] {
+	case "diff":
+		return diff(args[1:], stdout, stderr)
+	case "coverage":
+		return coverage(args[1:], stdout, stderr)
+	case "lint":
+		return lint(args[1:], stdout, stderr)
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n", args[0])
+		return 2
+	}
+}
+
+const (
+	diffUsage     = "usage: policyauthor diff [flags] old.yaml new.yaml --corpus requests.jsonl"
+	coverageUsage = "usage: policyauthor coverage [flags] policies.yaml --corpus requests.jsonl"
+	lintUsage     = "usage: policyauthor lint [flags] policies.yaml"
+)
+
+func diff(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var (
+		corpus   = fs.String("corpus", "", "path to a file of evaluation contexts, one JSON object per line, or - for stdin")
+		key      = fs.String("key", "policies", "dot separated path to the policies when a file holds a mapping")
+		examples = fs.Int("examples", 3, "number of example contexts shown per transition")
+		asJSON   = fs.Bool("json", false, "write the report as JSON")
+	)
+
+	files, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(files) != 2 || *corpus == "" {
+		fmt.Fprintln(stderr, diffUsage)
+		fs.PrintDefaults()
+		return 2
+	}
+
+	engines := make([]*policyauthor.PolicyEngine, len(files))
+	for i, f := range files {
+		if engines[i], _, err = loadEngine(f, *key); err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", f, err)
+			return 2
+		}
+	}
+
+	r, err := openCorpus(*corpus)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	defer r.Close()
+
+	report, err := replay.Diff(engines[0], engines[1], r, replay.Options{MaxExamples: *examples})
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", *corpus, err)
+		return 2
+	}
+
+	if *asJSON {
+		err = writeJSON(stdout, report)
+	} else {
+		err = report.WriteText(stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	if report.Changed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func coverage(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("coverage", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var (
+		corpus = fs.String("corpus", "", "path to a file of evaluation contexts, one JSON object per line, or - for stdin")
+		key    = fs.String("key", "policies", "dot separated path to the policies when the file holds a mapping")
+		html   = fs.String("html", "", "also write an HTML report annotating the policy file to this path")
+		asJSON = fs.Bool("json", false, "write the report as JSON")
+	)
+
+	files, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(files) != 1 || *corpus == "" {
+		fmt.Fprintln(stderr, coverageUsage)
+		fs.PrintDefaults()
+		return 2
+	}
+
+	engine, source, err := loadEngine(files[0], *key)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", files[0], err)
+		return 2
+	}
+	engine.EnableCoverage()
+
+	r, err := openCorpus(*corpus)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	defer r.Close()
+
+	err = replay.ReadCorpus(r, func(line int, ctx map[string]any) error {
+		engine.Evaluate(ctx)
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", *corpus, err)
+		return 2
+	}
+
+	report := engine.Coverage()
+	if *html != "" {
+		f, err := os.Create(*html)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		err = report.WriteHTML(f, files[0], source)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+	}
+
+	if *asJSON {
+		err = writeJSON(stdout, report)
+	} else {
+		err = report.WriteText(stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	return 0
+}
+
+func lint(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var (
+		key    = fs.String("key", "policies", "dot separated path to the policies when the file holds a mapping")
+		asJSON = fs.Bool("json", false, "write the warnings as JSON")
+	)
+
+	files, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(files) != 1 {
+		fmt.Fprintln(stderr, lintUsage)
+		fs.PrintDefaults()
+		return 2
+	}
+
+	engine, _, err := loadEngine(files[0], *key)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", files[0], err)
+		return 2
+	}
+
+	warnings := conditions.Analyze(engine)
+	if *asJSON {
+		if warnings == nil {
+			warnings = []*conditions.Warning{}
+		}
+		err = writeJSON(stdout, warnings)
+	} else {
+		for _, w := range warnings {
+			line := engine.Policies()[w.Policy].Line()
+			if _, err = fmt.Fprintf(stdout, "%s:%d: %s\n", files[0], line, w); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	if len(warnings) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// parseArgs parses the flags in args, which may follow the positional arguments, and returns the positional arguments.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+func openCorpus(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(path)
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// loadEngine reads the policies of a file holding either a list of policies,
+// or a mapping holding them at the dot separated key. It also returns the content of the file.
+func loadEngine(path, key string) (*policyauthor.PolicyEngine, []byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil, fmt.Errorf("empty file")
+	}
+
+	node := doc.Content[0]
+	if node.Kind == yaml.MappingNode && key != "" {
+		for _, k := range strings.Split(key, ".") {
+			if node = mappingValue(node, k); node == nil {
+				return nil, nil, fmt.Errorf("key %s not found", key)
+			}
+		}
+	}
+
+	pe := &policyauthor.PolicyEngine{}
+	if err := node.Decode(pe); err != nil {
+		return nil, nil, err
+	}
+	return pe, b, nil
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
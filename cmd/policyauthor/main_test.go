@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	oldPolicies = `
+policies:
+- value: internal
+  conditions:
+  - type: cidr
+    spec:
+      key: "remote_addr"
+      value: "10.0.0.0/8"
+`
+	newPolicies = `
+policies:
+- value: beta
+  conditions:
+  - type: glob
+    spec:
+      key: "path"
+      pattern: "/beta/**"
+- value: internal
+  conditions:
+  - type: cidr
+    spec:
+      key: "remote_addr"
+      value: "10.0.0.0/8"
+`
+	shadowedPolicies = `
+- value: admin
+  conditions:
+  - type: equal
+    spec:
+      key: "role"
+      value: "admin"
+- value: never
+  conditions:
+  - type: and
+    spec:
+      conditions:
+      - type: equal
+        spec:
+          key: "role"
+          value: "admin"
+      - type: exists
+        spec:
+          key: "user"
+`
+	corpus = `{"remote_addr": "10.0.0.1", "path": "/beta/a"}
+{"remote_addr": "10.0.0.2", "path": "/home"}
+`
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	return dir
+}
+
+func runCommand(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestDiff(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"old.yaml":       oldPolicies,
+		"new.yaml":       newPolicies,
+		"requests.jsonl": corpus,
+	})
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	code, stdout, stderr := runCommand("diff", path("old.yaml"), path("new.yaml"), "--corpus", path("requests.jsonl"))
+	assert.Equal(t, 1, code, stderr)
+	assert.Contains(t, stdout, "2 contexts replayed, 1 changed outcome.\n")
+	assert.Contains(t, stdout, `"internal" -> "beta" (1 context`)
+
+	code, stdout, stderr = runCommand("diff", "--json", path("old.yaml"), path("old.yaml"), "--corpus", path("requests.jsonl"))
+	assert.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, `"changed": 0`)
+
+	code, _, stderr = runCommand("diff", path("old.yaml"), "--corpus", path("requests.jsonl"))
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "usage: policyauthor diff")
+
+	code, _, stderr = runCommand("diff", path("old.yaml"), path("missing.yaml"), "--corpus", path("requests.jsonl"))
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "missing.yaml")
+}
+
+func TestCoverage(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"policies.yaml":  newPolicies,
+		"requests.jsonl": corpus,
+	})
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	code, stdout, stderr := runCommand("coverage", path("policies.yaml"), "--corpus", path("requests.jsonl"), "--html", path("coverage.html"))
+	assert.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, "policy 0 (line 3): hit 1, miss 1, error 0\n")
+	assert.Contains(t, stdout, "policies hit: 2/2\n")
+
+	html, err := os.ReadFile(path("coverage.html"))
+	require.NoError(t, err)
+	assert.Contains(t, string(html), `class="covered"`)
+
+	code, _, stderr = runCommand("coverage", path("policies.yaml"))
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, coverageUsage)
+}
+
+func TestLint(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"shadowed.yaml": shadowedPolicies,
+		"clean.yaml":    oldPolicies,
+	})
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	code, stdout, stderr := runCommand("lint", path("shadowed.yaml"))
+	assert.Equal(t, 1, code, stderr)
+	assert.Equal(t, path("shadowed.yaml")+":8: policy 1 is shadowed by policy 0\n", stdout)
+
+	code, stdout, stderr = runCommand("lint", "--json", path("clean.yaml"))
+	assert.Equal(t, 0, code, stderr)
+	assert.Equal(t, "[]", strings.TrimSpace(stdout))
+}
+
+func TestUnknownCommand(t *testing.T) {
+	code, _, stderr := runCommand("frobnicate")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, `unknown command "frobnicate"`)
+}
@@ -9,6 +9,11 @@ import (
 type Condition struct {
 	Type string        `yaml:"type"`
 	Spec ConditionSpec `yaml:"-"`
+
+	// line and column locate the condition in the YAML it was unmarshaled from.
+	line, column int `yaml:"-"`
+	// coverage records the outcomes of the condition while coverage is enabled.
+	coverage *coverageCounter `yaml:"-"`
 }
 
 func (c *Condition) UnmarshalYAML(value *yaml.Node) error {
@@ -18,6 +23,8 @@ func (c *Condition) UnmarshalYAML(value *yaml.Node) error {
 		Spec yaml.Node `yaml:"spec"`
 	}
 
+	c.line, c.column = value.Line, value.Column
+
 	obj := T{C: (*C)(c)}
 	if err := value.Decode(&obj); err != nil {
 		return err
@@ -44,6 +51,31 @@ func (c *Condition) UnmarshalYAML(value *yaml.Node) error {
 	return nil
 }
 
+// Evaluate evaluates the spec of the condition.
+// Condition specs holding other conditions should evaluate them with Evaluate rather than through their spec,
+// so that their outcomes are recorded while coverage is enabled.
+func (c *Condition) Evaluate(v map[string]any) (bool, error) {
+	hit, err := c.Spec.Evaluate(v)
+	if c.coverage != nil {
+		c.coverage.record(hit, err)
+	}
+	return hit, err
+}
+
+// EvaluateWithReturnValue is the ValueReturner counterpart of Evaluate.
+func (c *Condition) EvaluateWithReturnValue(v map[string]any) (any, bool, error) {
+	vr, ok := c.Spec.(ValueReturner)
+	if !ok {
+		return nil, false, fmt.Errorf("condition type %s does not return values", c.Type)
+	}
+
+	value, hit, err := vr.EvaluateWithReturnValue(v)
+	if c.coverage != nil {
+		c.coverage.record(hit, err)
+	}
+	return value, hit, err
+}
+
 func (c *Condition) String() string {
 	return c.Spec.String()
 }
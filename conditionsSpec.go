@@ -16,3 +16,44 @@ func RegisterConditions(m map[string]func() ConditionSpec) {
 		conditionsSpecMap[k] = v
 	}
 }
+
+// ConditionParent is implemented by condition specs that wrap other conditions.
+type ConditionParent interface {
+	Children() []*Condition
+}
+
+// Walk calls fn for c and each of its descendants in depth-first order.
+// If fn returns false, the descendants of that condition are skipped.
+func Walk(c *Condition, fn func(c *Condition) bool) {
+	if c == nil || !fn(c) {
+		return
+	}
+	if p, ok := c.Spec.(ConditionParent); ok {
+		for _, child := range p.Children() {
+			Walk(child, fn)
+		}
+	}
+}
+
+// KeyReader is implemented by condition specs to report the keys of the evaluation context they read,
+// not counting those read by their children. An empty key stands for the whole evaluation context.
+type KeyReader interface {
+	ContextKeys() []string
+}
+
+// Volatile is implemented by condition specs whose outcome may depend on more than the evaluation context,
+// such as the current time or previous evaluations.
+type Volatile interface {
+	Volatile() bool
+}
+
+// Stateful is implemented by condition specs keeping state across evaluations, such as rate limit buckets.
+// Each engine holds the state of its conditions, shared by those of the same type with the same StateKey.
+type Stateful interface {
+	// StateKey identifies the state of the condition, usually by its definition.
+	StateKey() string
+	// NewState returns empty state for the condition.
+	NewState() any
+	// SetState sets the state the condition uses, as returned by NewState for a condition with the same StateKey.
+	SetState(state any)
+}
@@ -0,0 +1,178 @@
+package policyauthor
+
+import "sync/atomic"
+
+// coverageCounter counts the outcomes of a policy or condition.
+type coverageCounter struct {
+	true, false, errors atomic.Uint64
+}
+
+func (c *coverageCounter) record(hit bool, err error) {
+	switch {
+	case err != nil:
+		c.errors.Add(1)
+	case hit:
+		c.true.Add(1)
+	default:
+		c.false.Add(1)
+	}
+}
+
+func (c *coverageCounter) counts() CoverageCounts {
+	if c == nil {
+		return CoverageCounts{}
+	}
+	return CoverageCounts{True: c.true.Load(), False: c.false.Load(), Errors: c.errors.Load()}
+}
+
+// EnableCoverage starts recording the outcomes of every policy and condition of the engine, discarding previous records.
+// It must not be called concurrently with Evaluate. Decisions are not cached while coverage is enabled.
+func (pe *PolicyEngine) EnableCoverage() {
+	pe.coverage = true
+	for _, p := range pe.policies {
+		p.coverage = &coverageCounter{}
+	}
+	pe.walk(func(c *Condition) bool {
+		c.coverage = &coverageCounter{}
+		return true
+	})
+}
+
+// DisableCoverage stops recording outcomes. It must not be called concurrently with Evaluate.
+func (pe *PolicyEngine) DisableCoverage() {
+	pe.coverage = false
+	for _, p := range pe.policies {
+		p.coverage = nil
+	}
+	pe.walk(func(c *Condition) bool {
+		c.coverage = nil
+		return true
+	})
+}
+
+// CoverageCounts counts the outcomes of a policy or condition.
+// For policies, True counts hits and False counts misses.
+type CoverageCounts struct {
+	True   uint64 `json:"true"`
+	False  uint64 `json:"false"`
+	Errors uint64 `json:"errors"`
+}
+
+// Reached reports whether the node was evaluated at all.
+func (c CoverageCounts) Reached() bool {
+	return c.True+c.False+c.Errors > 0
+}
+
+// Covered reports whether the node evaluated both true and false.
+func (c CoverageCounts) Covered() bool {
+	return c.True > 0 && c.False > 0
+}
+
+// CoverageReport holds the outcomes recorded for every policy of an engine since coverage was enabled.
+type CoverageReport struct {
+	Policies []*PolicyCoverage `json:"policies"`
+}
+
+// PolicyCoverage holds the outcomes recorded for a policy and its conditions.
+type PolicyCoverage struct {
+	CoverageCounts
+	Index int    `json:"index"`
+	Name  string `json:"name,omitempty"`
+	// Line is the line of the policy in the YAML it was unmarshaled from.
+	Line       int                  `json:"line"`
+	Conditions []*ConditionCoverage `json:"conditions"`
+}
+
+// ConditionCoverage holds the outcomes recorded for a condition and its children.
+type ConditionCoverage struct {
+	CoverageCounts
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	// Line and Column locate the condition in the YAML it was unmarshaled from.
+	Line     int                  `json:"line"`
+	Column   int                  `json:"column"`
+	Children []*ConditionCoverage `json:"children,omitempty"`
+}
+
+// CoverageSummary aggregates a CoverageReport.
+type CoverageSummary struct {
+	Policies    int `json:"policies"`
+	PoliciesHit int `json:"policiesHit"`
+	Conditions  int `json:"conditions"`
+	// Reached counts the conditions evaluated at least once.
+	Reached int `json:"reached"`
+	// Covered counts the conditions evaluated both true and false.
+	Covered int `json:"covered"`
+	// Errored counts the conditions that failed at least once.
+	Errored int `json:"errored"`
+}
+
+// Coverage returns the outcomes recorded since coverage was enabled, or nil if it is not enabled.
+func (pe *PolicyEngine) Coverage() *CoverageReport {
+	if !pe.coverage {
+		return nil
+	}
+
+	r := &CoverageReport{Policies: make([]*PolicyCoverage, len(pe.policies))}
+	for i, p := range pe.policies {
+		pc := &PolicyCoverage{
+			CoverageCounts: p.coverage.counts(),
+			Index:          i,
+			Name:           p.Name,
+			Line:           p.line,
+		}
+		for _, c := range p.Conditions {
+			pc.Conditions = append(pc.Conditions, conditionCoverage(c))
+		}
+		r.Policies[i] = pc
+	}
+
+	return r
+}
+
+func conditionCoverage(c *Condition) *ConditionCoverage {
+	cc := &ConditionCoverage{
+		CoverageCounts: c.coverage.counts(),
+		Type:           c.Type,
+		Description:    c.String(),
+		Line:           c.line,
+		Column:         c.column,
+	}
+	if cp, ok := c.Spec.(ConditionParent); ok {
+		for _, child := range cp.Children() {
+			cc.Children = append(cc.Children, conditionCoverage(child))
+		}
+	}
+	return cc
+}
+
+// Summary aggregates the report.
+func (r *CoverageReport) Summary() CoverageSummary {
+	var s CoverageSummary
+	for _, p := range r.Policies {
+		s.Policies++
+		if p.True > 0 {
+			s.PoliciesHit++
+		}
+		r.walk(p.Conditions, func(c *ConditionCoverage) {
+			s.Conditions++
+			if c.Reached() {
+				s.Reached++
+			}
+			if c.Covered() {
+				s.Covered++
+			}
+			if c.Errors > 0 {
+				s.Errored++
+			}
+		})
+	}
+	return s
+}
+
+func (r *CoverageReport) walk(conditions []*ConditionCoverage, fn func(c *ConditionCoverage)) {
+	for _, c := range conditions {
+		fn(c)
+		r.walk(c.Children, fn)
+	}
+}
@@ -0,0 +1,176 @@
+package policyauthor
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+// WriteText writes an indented rendering of the report, one line per policy and condition, followed by its summary.
+func (r *CoverageReport) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	for _, p := range r.Policies {
+		name := ""
+		if p.Name != "" {
+			name = fmt.Sprintf(" %q", p.Name)
+		}
+		fmt.Fprintf(bw, "policy %d%s (line %d): ", p.Index, name, p.Line)
+		if p.Reached() {
+			fmt.Fprintf(bw, "hit %d, miss %d, error %d\n", p.True, p.False, p.Errors)
+		} else {
+			fmt.Fprintln(bw, "never reached")
+		}
+		writeConditionsText(bw, p.Conditions, 1)
+	}
+
+	s := r.Summary()
+	fmt.Fprintf(bw, "\npolicies hit: %d/%d\n", s.PoliciesHit, s.Policies)
+	fmt.Fprintf(bw, "conditions reached: %d/%d (%s)\n", s.Reached, s.Conditions, percent(s.Reached, s.Conditions))
+	fmt.Fprintf(bw, "conditions evaluated both true and false: %d/%d (%s)\n", s.Covered, s.Conditions, percent(s.Covered, s.Conditions))
+	fmt.Fprintf(bw, "conditions with errors: %d\n", s.Errored)
+
+	return bw.Flush()
+}
+
+func writeConditionsText(w io.Writer, conditions []*ConditionCoverage, depth int) {
+	for _, c := range conditions {
+		fmt.Fprintf(w, "%s%s (line %d): %s", strings.Repeat("  ", depth), c.Type, c.Line, countsText(c.CoverageCounts))
+		if len(c.Children) == 0 {
+			fmt.Fprintf(w, " -- %s", c.Description)
+		}
+		fmt.Fprintln(w)
+		writeConditionsText(w, c.Children, depth+1)
+	}
+}
+
+func countsText(c CoverageCounts) string {
+	if !c.Reached() {
+		return "never reached"
+	}
+	return fmt.Sprintf("true %d, false %d, error %d", c.True, c.False, c.Errors)
+}
+
+func percent(n, total int) string {
+	if total == 0 {
+		return "100.0%"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(n)/float64(total))
+}
+
+// Coverage statuses, from worst to best.
+const (
+	coverageUnreached = iota
+	coveragePartial
+	coverageCovered
+)
+
+var coverageClasses = [...]string{"unreached", "partial", "covered"}
+
+type coverageLine struct {
+	Number int
+	Text   string
+	Class  string
+	Counts string
+}
+
+var coverageTemplate = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; font-family: monospace; font-size: 13px; }
+td { padding: 0 8px; white-space: pre; vertical-align: top; }
+td.num { color: #999; text-align: right; }
+td.counts { color: #555; }
+tr.unreached td.src { background: #f8d0d0; }
+tr.partial td.src { background: #f8eec0; }
+tr.covered td.src { background: #d0f0d0; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>Policies hit: {{.Summary.PoliciesHit}}/{{.Summary.Policies}}.
+Conditions reached: {{.Summary.Reached}}/{{.Summary.Conditions}},
+evaluated both true and false: {{.Summary.Covered}}/{{.Summary.Conditions}},
+with errors: {{.Summary.Errored}}.</p>
+<p><span style="background: #d0f0d0">true and false</span>
+<span style="background: #f8eec0">only true or only false</span>
+<span style="background: #f8d0d0">never reached</span></p>
+<table>
+{{range .Lines}}<tr{{if .Class}} class="{{.Class}}"{{end}}><td class="num">{{.Number}}</td><td class="counts">{{.Counts}}</td><td class="src">{{.Text}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// WriteHTML writes an HTML page annotating source, the YAML the engine was unmarshaled from,
+// with the outcomes recorded for the policy or condition starting on each line.
+func (r *CoverageReport) WriteHTML(w io.Writer, title string, source []byte) error {
+	type annotation struct {
+		status int
+		counts []string
+	}
+	annotations := map[int]*annotation{}
+	annotate := func(line, status int, counts string) {
+		a, ok := annotations[line]
+		if !ok {
+			a = &annotation{status: status}
+			annotations[line] = a
+		}
+		a.status = min(a.status, status)
+		a.counts = append(a.counts, counts)
+	}
+
+	for _, p := range r.Policies {
+		status := coverageUnreached
+		switch {
+		case p.Covered():
+			status = coverageCovered
+		case p.Reached():
+			status = coveragePartial
+		}
+		counts := "never reached"
+		if p.Reached() {
+			counts = fmt.Sprintf("hit %d, miss %d, error %d", p.True, p.False, p.Errors)
+		}
+		annotate(p.Line, status, counts)
+
+		r.walk(p.Conditions, func(c *ConditionCoverage) {
+			status := coverageUnreached
+			switch {
+			case c.Covered():
+				status = coverageCovered
+			case c.Reached():
+				status = coveragePartial
+			}
+			annotate(c.Line, status, countsText(c.CoverageCounts))
+		})
+	}
+
+	source = bytes.TrimSuffix(source, []byte("\n"))
+	var lines []coverageLine
+	for i, text := range strings.Split(string(source), "\n") {
+		l := coverageLine{Number: i + 1, Text: text}
+		if a, ok := annotations[l.Number]; ok {
+			l.Class = coverageClasses[a.status]
+			l.Counts = strings.Join(a.counts, "; ")
+		}
+		lines = append(lines, l)
+	}
+
+	return coverageTemplate.Execute(w, struct {
+		Title   string
+		Summary CoverageSummary
+		Lines   []coverageLine
+	}{
+		Title:   title,
+		Summary: r.Summary(),
+		Lines:   lines,
+	})
+}
@@ -0,0 +1,31 @@
+package policyauthor
+
+import "time"
+
+// DecisionLogger is implemented by types recording the decisions of a PolicyEngine.
+// LogDecision is called once per evaluation and may be called concurrently.
+// The record must not be modified, and its Context must not be retained as is, since it shares values with the evaluation context.
+type DecisionLogger interface {
+	LogDecision(r *DecisionRecord)
+}
+
+// DecisionRecord describes a single decision of a PolicyEngine.
+type DecisionRecord struct {
+	// Time is the time of the decision according to the engine clock.
+	Time          time.Time
+	EngineVersion string
+	// Policy identifies the policy that hit by its name, or by its index if it has none.
+	// It is empty when no policy hit.
+	Policy string
+	// PolicyIndex is the index of the policy that hit, or that failed when Err is set.
+	// It is -1 on misses and when evaluation failed before any policy was evaluated.
+	PolicyIndex int
+	Hit         bool
+	Value       any
+	Err         error
+	// Context holds the values of the keys of the evaluation context read by the policies evaluated
+	// to reach the decision, keyed by their path. Keys missing from the evaluation context are omitted,
+	// and the empty key holds the whole evaluation context.
+	Context  map[string]any
+	Duration time.Duration
+}
@@ -4,6 +4,7 @@ go 1.22.1
 
 require (
 	github.com/stretchr/testify v1.9.0
+	golang.org/x/text v0.21.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
@@ -0,0 +1,19 @@
+package policyauthor
+
+import "time"
+
+// Metrics is implemented by types collecting statistics about the evaluations of a PolicyEngine.
+// ObserveEvaluation is called once per evaluation and may be called concurrently.
+type Metrics interface {
+	ObserveEvaluation(o Observation)
+}
+
+// Observation describes a single evaluation of a PolicyEngine.
+type Observation struct {
+	// Policy identifies the policy that hit by its name, or by its index if it has none.
+	// It is empty when no policy hit.
+	Policy   string
+	Hit      bool
+	Err      error
+	Duration time.Duration
+}
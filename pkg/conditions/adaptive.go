@@ -0,0 +1,216 @@
+package conditions
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/raphaelreyna/policyauthor"
+)
+
+// defaultReorderEvery is the default number of evaluations between two reorderings of adaptive and and or conditions.
+const defaultReorderEvery = 1000
+
+// ChildStats describes the recent evaluations of a child of an adaptive and or or condition.
+// Its counts and durations are halved on each reordering, so that older evaluations weigh less in the order.
+type ChildStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	Errors uint64 `json:"errors"`
+	// Latency is the mean duration of the evaluations of the child.
+	Latency time.Duration `json:"latency"`
+}
+
+// Evaluations returns the number of evaluations of the child.
+func (s ChildStats) Evaluations() uint64 {
+	return s.Hits + s.Misses + s.Errors
+}
+
+// adaptiveOrder evaluates the children of an and or or condition in an order learned from their evaluations:
+// children are periodically sorted by their mean latency divided by the rate at which they end the evaluation,
+// so that cheap children ending it often come first.
+type adaptiveOrder struct {
+	// stop is the outcome of a child ending the evaluation, false for and conditions and true for or conditions.
+	stop  bool
+	every uint64
+
+	state       atomic.Pointer[adaptiveState]
+	evaluations atomic.Uint64
+	// mu serializes reorderings and resets.
+	mu sync.Mutex
+}
+
+type adaptiveState struct {
+	// order holds the indexes of the children in evaluation order.
+	order []int
+	// stats holds the statistics of the children, in declared order.
+	stats []adaptiveStats
+}
+
+type adaptiveStats struct {
+	hits, misses, errors atomic.Uint64
+	nanos                atomic.Int64
+}
+
+// newAdaptiveOrder returns the adaptive order of conditions, which must not return values nor keep state.
+func newAdaptiveOrder(conditions []*policyauthor.Condition, stop bool, every int) (*adaptiveOrder, error) {
+	for _, c := range conditions {
+		if valueReturnEnabled(c) {
+			return nil, fmt.Errorf("condition %s returns values", c)
+		}
+		if stateful(c) {
+			return nil, fmt.Errorf("condition %s keeps state across evaluations", c)
+		}
+	}
+
+	if every < 0 {
+		return nil, fmt.Errorf("reorderEvery must not be negative")
+	}
+	if every == 0 {
+		every = defaultReorderEvery
+	}
+
+	a := &adaptiveOrder{stop: stop, every: uint64(every)}
+	a.reset(len(conditions))
+	return a, nil
+}
+
+// reset restores the declared order of n children and discards their statistics.
+func (a *adaptiveOrder) reset(n int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	state := &adaptiveState{order: make([]int, n), stats: make([]adaptiveStats, n)}
+	for i := range state.order {
+		state.order[i] = i
+	}
+	a.evaluations.Store(0)
+	a.state.Store(state)
+}
+
+func (a *adaptiveOrder) evaluate(conditions []*policyauthor.Condition, v map[string]any) (bool, error) {
+	state := a.state.Load()
+
+	hit, err := !a.stop, error(nil)
+	for _, i := range state.order {
+		start := time.Now()
+		h, e := conditions[i].Evaluate(v)
+		s := &state.stats[i]
+		s.nanos.Add(int64(time.Since(start)))
+		switch {
+		case e != nil:
+			s.errors.Add(1)
+		case h:
+			s.hits.Add(1)
+		default:
+			s.misses.Add(1)
+		}
+
+		if e != nil {
+			hit, err = false, e
+			break
+		}
+		if h == a.stop {
+			hit = a.stop
+			break
+		}
+	}
+
+	if a.evaluations.Add(1)%a.every == 0 && a.mu.TryLock() {
+		a.reorder()
+		a.mu.Unlock()
+	}
+
+	return hit, err
+}
+
+// reorder sorts the children by score, leaving those that did not end an evaluation recently last,
+// then halves their statistics.
+// It must be called with mu held.
+func (a *adaptiveOrder) reorder() {
+	state := a.state.Load()
+	order := slices.Clone(state.order)
+	scores := make([]float64, len(order))
+	for i := range state.stats {
+		s := &state.stats[i]
+		// Failing children are not moved ahead for failing often, which would only make evaluations fail more often.
+		ends := s.misses.Load()
+		if a.stop {
+			ends = s.hits.Load()
+		}
+		if ends == 0 {
+			scores[i] = math.Inf(1)
+			continue
+		}
+		// The mean latency divided by the rate at which the child ends the evaluation.
+		scores[i] = float64(s.nanos.Load()) / float64(ends)
+	}
+
+	slices.SortStableFunc(order, func(i, j int) int {
+		switch {
+		case scores[i] < scores[j]:
+			return -1
+		case scores[i] > scores[j]:
+			return 1
+		}
+		return 0
+	})
+	a.state.Store(&adaptiveState{order: order, stats: state.stats})
+
+	for i := range state.stats {
+		state.stats[i].decay()
+	}
+}
+
+// decay halves the statistics, keeping evaluations recorded concurrently.
+func (s *adaptiveStats) decay() {
+	for _, n := range []*atomic.Uint64{&s.hits, &s.misses, &s.errors} {
+		n.Add(^(n.Load() / 2) + 1)
+	}
+	s.nanos.Add(-s.nanos.Load() / 2)
+}
+
+func (s *adaptiveStats) childStats() ChildStats {
+	cs := ChildStats{Hits: s.hits.Load(), Misses: s.misses.Load(), Errors: s.errors.Load()}
+	if n := cs.Evaluations(); n > 0 {
+		cs.Latency = time.Duration(s.nanos.Load() / int64(n))
+	}
+	return cs
+}
+
+func (a *adaptiveOrder) evaluationOrder(conditions []*policyauthor.Condition) []*policyauthor.Condition {
+	if a == nil {
+		return slices.Clone(conditions)
+	}
+	order := a.state.Load().order
+	out := make([]*policyauthor.Condition, len(order))
+	for i, j := range order {
+		out[i] = conditions[j]
+	}
+	return out
+}
+
+func (a *adaptiveOrder) allChildStats() []ChildStats {
+	if a == nil {
+		return nil
+	}
+	state := a.state.Load()
+	out := make([]ChildStats, len(state.stats))
+	for i := range out {
+		out[i] = state.stats[i].childStats()
+	}
+	return out
+}
+
+// stateful reports whether c or any of its descendants keeps state across evaluations.
+func stateful(c *policyauthor.Condition) bool {
+	found := false
+	policyauthor.Walk(c, func(c *policyauthor.Condition) bool {
+		_, found = c.Spec.(policyauthor.Stateful)
+		return !found
+	})
+	return found
+}
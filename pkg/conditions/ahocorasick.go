@@ -0,0 +1,90 @@
+package conditions
+
+// ahoCorasick is an automaton that finds whether any of a set of needles occurs in a haystack in a single pass.
+type ahoCorasick struct {
+	nodes []acNode
+}
+
+type acNode struct {
+	next map[byte]int32
+	fail int32
+	// out is set when a needle ends at this node or at any node along its failure chain.
+	out bool
+}
+
+func newAhoCorasick(needles []string) *ahoCorasick {
+	ac := &ahoCorasick{nodes: []acNode{{next: map[byte]int32{}}}}
+
+	for _, needle := range needles {
+		n := int32(0)
+		for i := 0; i < len(needle); i++ {
+			c := needle[i]
+			child, ok := ac.nodes[n].next[c]
+			if !ok {
+				child = int32(len(ac.nodes))
+				ac.nodes = append(ac.nodes, acNode{next: map[byte]int32{}})
+				ac.nodes[n].next[c] = child
+			}
+			n = child
+		}
+		ac.nodes[n].out = true
+	}
+
+	// Breadth first construction of the failure links.
+	queue := make([]int32, 0, len(ac.nodes))
+	for _, child := range ac.nodes[0].next {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+
+		for c, child := range ac.nodes[n].next {
+			f := ac.nodes[n].fail
+			for {
+				if next, ok := ac.nodes[f].next[c]; ok && next != child {
+					ac.nodes[child].fail = next
+					break
+				}
+				if f == 0 {
+					break
+				}
+				f = ac.nodes[f].fail
+			}
+			if ac.nodes[ac.nodes[child].fail].out {
+				ac.nodes[child].out = true
+			}
+			queue = append(queue, child)
+		}
+	}
+
+	return ac
+}
+
+// matchString reports whether any needle occurs in s.
+func (ac *ahoCorasick) matchString(s string) bool {
+	if ac.nodes[0].out {
+		// The empty needle matches everything.
+		return true
+	}
+
+	n := int32(0)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		for {
+			if next, ok := ac.nodes[n].next[c]; ok {
+				n = next
+				break
+			}
+			if n == 0 {
+				break
+			}
+			n = ac.nodes[n].fail
+		}
+		if ac.nodes[n].out {
+			return true
+		}
+	}
+
+	return false
+}
@@ -4,15 +4,30 @@ import "github.com/raphaelreyna/policyauthor"
 
 func AllConditionsMap() map[string]func() policyauthor.ConditionSpec {
 	return map[string]func() policyauthor.ConditionSpec{
-		"and":      func() policyauthor.ConditionSpec { return &AndSpec{} },
-		"or":       func() policyauthor.ConditionSpec { return &OrSpec{} },
-		"not":      func() policyauthor.ConditionSpec { return &NotSpec{} },
-		"contains": func() policyauthor.ConditionSpec { return &SubstringSpec{} },
-		"equal":    func() policyauthor.ConditionSpec { return &EqualSpec{} },
-		"cidr":     func() policyauthor.ConditionSpec { return &CIDRSpec{} },
-		"regex":    func() policyauthor.ConditionSpec { return &RegexSpec{} },
-		"time":     func() policyauthor.ConditionSpec { return &TimeSpec{} },
-		"range":    func() policyauthor.ConditionSpec { return &RangeSpec{} },
-		"exists":   func() policyauthor.ConditionSpec { return &ExistsSpec{} },
+		"and":        func() policyauthor.ConditionSpec { return &AndSpec{} },
+		"or":         func() policyauthor.ConditionSpec { return &OrSpec{} },
+		"not":        func() policyauthor.ConditionSpec { return &NotSpec{} },
+		"any":        func() policyauthor.ConditionSpec { return &AnySpec{} },
+		"all":        func() policyauthor.ConditionSpec { return &AllSpec{} },
+		"none":       func() policyauthor.ConditionSpec { return &NoneSpec{} },
+		"count":      func() policyauthor.ConditionSpec { return &CountSpec{} },
+		"contains":   func() policyauthor.ConditionSpec { return &SubstringSpec{} },
+		"equal":      func() policyauthor.ConditionSpec { return &EqualSpec{} },
+		"cidr":       func() policyauthor.ConditionSpec { return &CIDRSpec{} },
+		"regex":      func() policyauthor.ConditionSpec { return &RegexSpec{} },
+		"glob":       func() policyauthor.ConditionSpec { return &GlobSpec{} },
+		"time":       func() policyauthor.ConditionSpec { return &TimeSpec{} },
+		"range":      func() policyauthor.ConditionSpec { return &RangeSpec{} },
+		"semver":     func() policyauthor.ConditionSpec { return &SemverSpec{} },
+		"exists":     func() policyauthor.ConditionSpec { return &ExistsSpec{} },
+		"length":     func() policyauthor.ConditionSpec { return &LengthSpec{} },
+		"type":       func() policyauthor.ConditionSpec { return &TypeSpec{} },
+		"jsonschema": func() policyauthor.ConditionSpec { return &JSONSchemaSpec{} },
+		"rollout":    func() policyauthor.ConditionSpec { return &RolloutSpec{} },
+		"ratelimit":  func() policyauthor.ConditionSpec { return &RateLimitSpec{} },
+		"schedule":   func() policyauthor.ConditionSpec { return &ScheduleSpec{} },
+		"in":         func() policyauthor.ConditionSpec { return &InSpec{} },
+		"notIn":      func() policyauthor.ConditionSpec { return &NotInSpec{} },
+		"string":     func() policyauthor.ConditionSpec { return &StringSpec{} },
 	}
 }
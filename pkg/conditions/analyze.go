@@ -0,0 +1,572 @@
+package conditions
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/raphaelreyna/policyauthor"
+)
+
+// maxAnalysisTerms bounds the number of alternatives a condition is expanded into during analysis.
+// Conditions expanding into more alternatives are treated as opaque.
+const maxAnalysisTerms = 256
+
+// WarningKind classifies the findings of Analyze.
+type WarningKind string
+
+const (
+	// Unreachable policies can never match.
+	Unreachable WarningKind = "unreachable"
+	// Shadowed policies only match contexts that earlier policies already match.
+	Shadowed WarningKind = "shadowed"
+	// DeadCondition conditions can never match, although their policy can through its other conditions.
+	DeadCondition WarningKind = "deadCondition"
+)
+
+// Warning is a finding of Analyze.
+type Warning struct {
+	Kind WarningKind `json:"kind"`
+	// Policy is the index of the policy the warning is about.
+	Policy int `json:"policy"`
+	// Condition is the index of the condition within the policy for DeadCondition warnings, and -1 otherwise.
+	Condition int `json:"condition"`
+	// ShadowedBy lists the indexes of the earlier policies matching every context a Shadowed policy matches.
+	ShadowedBy []int  `json:"shadowedBy,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+func (w *Warning) String() string {
+	switch w.Kind {
+	case Unreachable:
+		return fmt.Sprintf("policy %d can never match: %s", w.Policy, w.Reason)
+	case DeadCondition:
+		return fmt.Sprintf("condition %d of policy %d can never match: %s", w.Condition, w.Policy, w.Reason)
+	case Shadowed:
+		by := make([]string, len(w.ShadowedBy))
+		for i, p := range w.ShadowedBy {
+			by[i] = fmt.Sprint(p)
+		}
+		noun := "policy"
+		if len(by) > 1 {
+			noun = "policies"
+		}
+		return fmt.Sprintf("policy %d is shadowed by %s %s", w.Policy, noun, strings.Join(by, ", "))
+	default:
+		return fmt.Sprintf("policy %d: %s", w.Policy, w.Reason)
+	}
+}
+
+// Analyze statically looks for policies of pe that can never match, either because their conditions
+// contradict themselves or because earlier policies already match every context they match.
+//
+// The analysis understands and, or, not, exists, equal, in, notIn and range conditions, and compares other
+// conditions by their definition. It is conservative: it may miss problems, but the problems it reports are real.
+// Contexts on which evaluation fails are not considered matched by any policy.
+// Conditions whose outcome depends on more than the evaluation context, such as rate limits, are never assumed
+// to evaluate like another condition, even one with the same definition.
+// Analyze must not be called concurrently with Evaluate.
+func Analyze(pe *policyauthor.PolicyEngine) []*Warning {
+	var (
+		warnings []*Warning
+		// earlier holds the satisfiable alternatives of the policies analyzed so far.
+		earlier []analysisTerm
+	)
+
+	for i, p := range pe.Policies() {
+		var (
+			terms  []analysisTerm
+			reason string
+		)
+		for j, c := range p.Conditions {
+			var condTerms []analysisTerm
+			condReason := ""
+			for _, t := range conditionTerms(c) {
+				if r, unsat := t.contradiction(); unsat {
+					if condReason == "" {
+						condReason = r
+					}
+					continue
+				}
+				condTerms = append(condTerms, analysisTerm{policy: i, literals: t})
+			}
+
+			if len(condTerms) == 0 {
+				if reason == "" {
+					reason = condReason
+				}
+				if len(p.Conditions) > 1 {
+					warnings = append(warnings, &Warning{Kind: DeadCondition, Policy: i, Condition: j, Reason: condReason})
+				}
+			}
+			terms = append(terms, condTerms...)
+		}
+
+		if len(terms) == 0 {
+			// Dead condition warnings are redundant with this one.
+			warnings = slices.DeleteFunc(warnings, func(w *Warning) bool { return w.Policy == i })
+			warnings = append(warnings, &Warning{Kind: Unreachable, Policy: i, Condition: -1, Reason: reason})
+			continue
+		}
+
+		var by []int
+		shadowed := true
+		for _, t := range terms {
+			idx := slices.IndexFunc(earlier, func(e analysisTerm) bool { return e.literals.impliedBy(t.literals) })
+			if idx < 0 {
+				shadowed = false
+				break
+			}
+			by = append(by, earlier[idx].policy)
+		}
+		if shadowed {
+			slices.Sort(by)
+			warnings = append(warnings, &Warning{Kind: Shadowed, Policy: i, Condition: -1, ShadowedBy: slices.Compact(by)})
+		}
+
+		earlier = append(earlier, terms...)
+	}
+
+	return warnings
+}
+
+type analysisTerm struct {
+	policy   int
+	literals term
+}
+
+// literal is a leaf condition that must evaluate to true, or to false when neg is set, without error.
+type literal struct {
+	spec policyauthor.ConditionSpec
+	neg  bool
+}
+
+func newLiteral(c *policyauthor.Condition, neg bool) literal {
+	if s, ok := c.Spec.(*NotInSpec); ok {
+		return literal{spec: &s.InSpec, neg: !neg}
+	}
+	return literal{spec: c.Spec, neg: neg}
+}
+
+// sameCondition reports whether l and o test the same condition, regardless of their negation.
+func (l literal) sameCondition(o literal) bool {
+	return sameSpec(l.spec, o.spec)
+}
+
+// sameSpec reports whether a and b are identical definitions of conditions whose outcome only depends on
+// the evaluation context, and therefore evaluate alike. Definitions holding functions are never identical.
+func sameSpec(a, b policyauthor.ConditionSpec) bool {
+	if volatileSpec(a) || volatileSpec(b) {
+		return false
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// volatileSpec reports whether the outcome of a condition with spec, or of one of its descendants,
+// depends on more than the evaluation context.
+func volatileSpec(spec policyauthor.ConditionSpec) bool {
+	return volatile(&policyauthor.Condition{Spec: spec})
+}
+
+// volatile reports whether the outcome of c or of one of its descendants depends on more than the evaluation context.
+func volatile(c *policyauthor.Condition) bool {
+	found := false
+	policyauthor.Walk(c, func(c *policyauthor.Condition) bool {
+		if v, ok := c.Spec.(policyauthor.Volatile); ok && v.Volatile() {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+func (l literal) String() string {
+	if l.neg {
+		return fmt.Sprintf("NOT (%s)", l.spec)
+	}
+	return l.spec.String()
+}
+
+// term is a conjunction of literals.
+type term []literal
+
+// conditionTerms returns the alternatives of c, falling back to c itself when it expands into too many.
+func conditionTerms(c *policyauthor.Condition) []term {
+	terms, ok := expand(c, false)
+	if !ok {
+		return []term{{newLiteral(c, false)}}
+	}
+	return terms
+}
+
+// expand returns c, negated when neg is set, in disjunctive normal form.
+// It returns false if the form has more than maxAnalysisTerms terms.
+func expand(c *policyauthor.Condition, neg bool) ([]term, bool) {
+	var (
+		children []*policyauthor.Condition
+		conjunct bool
+	)
+	switch s := c.Spec.(type) {
+	case *AndSpec:
+		children, conjunct = s.Conditions, !neg
+	case *OrSpec:
+		children, conjunct = s.Conditions, neg
+	case *NotSpec:
+		return expand(&s.Condition, !neg)
+	default:
+		return []term{{newLiteral(c, neg)}}, true
+	}
+
+	if !conjunct {
+		var terms []term
+		for _, child := range children {
+			ct, ok := expand(child, neg)
+			if !ok || len(terms)+len(ct) > maxAnalysisTerms {
+				return nil, false
+			}
+			terms = append(terms, ct...)
+		}
+		return terms, true
+	}
+
+	terms := []term{{}}
+	for _, child := range children {
+		ct, ok := expand(child, neg)
+		if !ok || len(terms)*len(ct) > maxAnalysisTerms {
+			return nil, false
+		}
+
+		product := make([]term, 0, len(terms)*len(ct))
+		for _, a := range terms {
+			for _, b := range ct {
+				product = append(product, append(slices.Clip(a), b...))
+			}
+		}
+		terms = product
+	}
+	return terms, true
+}
+
+// requiredKeys returns the keys, and their parents, that must be present for the literals of t to hold.
+func (t term) requiredKeys() map[string]literal {
+	required := map[string]literal{}
+	for _, l := range t {
+		var keys []string
+		if s, ok := l.spec.(*ExistsSpec); ok {
+			if !l.neg {
+				keys = []string{s.Key}
+			}
+		} else if kr, ok := l.spec.(policyauthor.KeyReader); ok && isBuiltin(l.spec) {
+			// Every other built-in leaf fails when the keys it reads are missing.
+			keys = kr.ContextKeys()
+		}
+
+		for _, k := range keys {
+			for k != "" {
+				if _, ok := required[k]; !ok {
+					required[k] = l
+				}
+				i := strings.LastIndexByte(k, '.')
+				if i < 0 {
+					break
+				}
+				k = k[:i]
+			}
+		}
+	}
+	return required
+}
+
+var builtinPkgPath = reflect.TypeOf(ExistsSpec{}).PkgPath()
+
+// isBuiltin reports whether spec is one of the conditions of this package.
+func isBuiltin(spec policyauthor.ConditionSpec) bool {
+	t := reflect.TypeOf(spec)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.PkgPath() == builtinPkgPath
+}
+
+// contradiction reports whether the literals of t can never hold together, and why.
+func (t term) contradiction() (string, bool) {
+	for i, l := range t {
+		for _, other := range t[:i] {
+			if other.neg != l.neg && other.sameCondition(l) {
+				return fmt.Sprintf("%s is required both to match and not to match", l.spec), true
+			}
+		}
+	}
+
+	required := t.requiredKeys()
+	for _, l := range t {
+		if s, ok := l.spec.(*ExistsSpec); ok && l.neg {
+			if r, ok := required[s.Key]; ok {
+				return fmt.Sprintf("key %s must not exist but is read by %s", s.Key, r), true
+			}
+		}
+	}
+
+	for i, a := range t {
+		if r, ok := a.spec.(*RangeSpec); ok && !a.neg && newInterval(r).empty() {
+			return fmt.Sprintf("range %s is empty", r), true
+		}
+		for _, b := range t[i+1:] {
+			if conflicting(a, b) || conflicting(b, a) {
+				return fmt.Sprintf("%s contradicts %s", a, b), true
+			}
+		}
+	}
+
+	// Ranges on the same key must overlap.
+	intervals := map[string]interval{}
+	for _, l := range t {
+		r, ok := l.spec.(*RangeSpec)
+		if !ok || l.neg {
+			continue
+		}
+		iv := newInterval(r)
+		if prev, ok := intervals[r.Key]; ok {
+			iv = prev.intersect(iv)
+		}
+		if iv.empty() {
+			return fmt.Sprintf("the ranges on key %s do not overlap", r.Key), true
+		}
+		intervals[r.Key] = iv
+	}
+
+	return "", false
+}
+
+// conflicting reports whether a and b can never hold together.
+func conflicting(a, b literal) bool {
+	if a.neg {
+		return false
+	}
+
+	switch s := a.spec.(type) {
+	case *EqualSpec:
+		if !s.Coerce {
+			return equalConflicts(s, b)
+		}
+	case *InSpec:
+		if o, ok := b.spec.(*InSpec); ok && !b.neg && o.Key == s.Key {
+			// The lists must share a value.
+			return !slices.ContainsFunc(s.Values, func(v any) bool {
+				return slices.ContainsFunc(o.Values, func(w any) bool {
+					return equalValues(v, w, equalOptions{foldCase: s.CaseInsensitive || o.CaseInsensitive})
+				})
+			})
+		}
+	}
+
+	return false
+}
+
+// equalConflicts reports whether eq and l can never hold together.
+func equalConflicts(eq *EqualSpec, l literal) bool {
+	switch s := l.spec.(type) {
+	case *EqualSpec:
+		if s.Key != eq.Key || s.Coerce {
+			return false
+		}
+		if !l.neg {
+			return !equalValues(eq.Value, s.Value, equalOptions{foldCase: eq.CaseInsensitive || s.CaseInsensitive})
+		}
+		// Every value equal to eq.Value must also equal s.Value.
+		return (!eq.CaseInsensitive || s.CaseInsensitive) &&
+			equalValues(eq.Value, s.Value, equalOptions{foldCase: s.CaseInsensitive})
+	case *InSpec:
+		if s.Key != eq.Key {
+			return false
+		}
+		if !l.neg {
+			return !slices.ContainsFunc(s.Values, func(v any) bool {
+				return equalValues(eq.Value, v, equalOptions{foldCase: eq.CaseInsensitive || s.CaseInsensitive})
+			})
+		}
+		return (!eq.CaseInsensitive || s.CaseInsensitive) && s.contains(eq.Value)
+	case *RangeSpec:
+		if s.Key != eq.Key || l.neg {
+			return false
+		}
+		n, ok := toNumber(eq.Value, s.NumericStrings)
+		if !ok {
+			// The range fails on values that are not numbers,
+			// only case variants of a string could spell one.
+			_, isString := eq.Value.(string)
+			return !isString || !eq.CaseInsensitive
+		}
+		return !newInterval(s).contains(n)
+	}
+
+	return false
+}
+
+// contains reports whether v is one of the values of s.
+func (s *InSpec) contains(v any) bool {
+	k, err := scalarKey(v, s.CaseInsensitive)
+	if err != nil {
+		return false
+	}
+	_, ok := s.set[k]
+	return ok
+}
+
+// impliedBy reports whether the literals of t hold whenever those of other do.
+func (t term) impliedBy(other term) bool {
+	var required map[string]literal
+	for _, l := range t {
+		if slices.ContainsFunc(other, func(o literal) bool { return o.neg == l.neg && o.sameCondition(l) }) {
+			continue
+		}
+
+		if s, ok := l.spec.(*ExistsSpec); ok && !l.neg {
+			if required == nil {
+				required = other.requiredKeys()
+			}
+			if _, ok := required[s.Key]; ok {
+				continue
+			}
+			return false
+		}
+
+		if !slices.ContainsFunc(other, func(o literal) bool { return implies(o, l) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// implies reports whether l holds whenever o does.
+func implies(o, l literal) bool {
+	switch s := l.spec.(type) {
+	case *EqualSpec:
+		eq, ok := o.spec.(*EqualSpec)
+		if !ok || o.neg || eq.Key != s.Key || eq.Coerce || (eq.CaseInsensitive && !s.CaseInsensitive) {
+			return false
+		}
+		// The value at the key equals eq.Value.
+		opts := equalOptions{foldCase: s.CaseInsensitive, coerce: s.Coerce}
+		return equalValues(eq.Value, s.Value, opts) != l.neg
+	case *InSpec:
+		switch os := o.spec.(type) {
+		case *EqualSpec:
+			if o.neg || os.Key != s.Key || os.Coerce || (os.CaseInsensitive && !s.CaseInsensitive) {
+				return false
+			}
+			if _, err := scalarKey(os.Value, false); err != nil {
+				return false
+			}
+			return s.contains(os.Value) != l.neg
+		case *InSpec:
+			if os.Key != s.Key || o.neg != l.neg {
+				return false
+			}
+			if !l.neg {
+				// Every value of os must be a value of s.
+				return (!os.CaseInsensitive || s.CaseInsensitive) && !slices.ContainsFunc(os.Values, func(v any) bool { return !s.contains(v) })
+			}
+			// Every value of s must be a value of os.
+			return (!s.CaseInsensitive || os.CaseInsensitive) && !slices.ContainsFunc(s.Values, func(v any) bool { return !os.contains(v) })
+		}
+	case *RangeSpec:
+		if l.neg {
+			return false
+		}
+		switch os := o.spec.(type) {
+		case *EqualSpec:
+			if o.neg || os.Key != s.Key || os.Coerce {
+				return false
+			}
+			n, ok := toNumber(os.Value, s.NumericStrings)
+			return ok && newInterval(s).contains(n)
+		case *RangeSpec:
+			if o.neg || os.Key != s.Key || (os.NumericStrings && !s.NumericStrings) {
+				return false
+			}
+			return newInterval(os).within(newInterval(s))
+		}
+	}
+	return false
+}
+
+// interval is the set of numbers accepted by a range.
+type interval struct {
+	lo, hi         *Number
+	loIncl, hiIncl bool
+}
+
+func newInterval(s *RangeSpec) interval {
+	iv := interval{lo: s.Lower, loIncl: true, hi: s.Upper, hiIncl: true}
+	if s.GreaterThan != nil {
+		iv.lo, iv.loIncl = s.GreaterThan, false
+	}
+	if s.LessThan != nil {
+		iv.hi, iv.hiIncl = s.LessThan, false
+	}
+	return iv
+}
+
+func (iv interval) empty() bool {
+	if iv.lo == nil || iv.hi == nil {
+		return false
+	}
+	c := compareNumbers(*iv.lo, *iv.hi)
+	return c > 0 || (c == 0 && !(iv.loIncl && iv.hiIncl))
+}
+
+func (iv interval) contains(n Number) bool {
+	if iv.lo != nil {
+		if c := compareNumbers(n, *iv.lo); c < 0 || (c == 0 && !iv.loIncl) {
+			return false
+		}
+	}
+	if iv.hi != nil {
+		if c := compareNumbers(n, *iv.hi); c > 0 || (c == 0 && !iv.hiIncl) {
+			return false
+		}
+	}
+	return true
+}
+
+func (iv interval) intersect(other interval) interval {
+	out := iv
+	if other.lo != nil {
+		if out.lo == nil {
+			out.lo, out.loIncl = other.lo, other.loIncl
+		} else if c := compareNumbers(*other.lo, *out.lo); c > 0 || (c == 0 && !other.loIncl) {
+			out.lo, out.loIncl = other.lo, other.loIncl
+		}
+	}
+	if other.hi != nil {
+		if out.hi == nil {
+			out.hi, out.hiIncl = other.hi, other.hiIncl
+		} else if c := compareNumbers(*other.hi, *out.hi); c < 0 || (c == 0 && !other.hiIncl) {
+			out.hi, out.hiIncl = other.hi, other.hiIncl
+		}
+	}
+	return out
+}
+
+// within reports whether every number of iv is in other.
+func (iv interval) within(other interval) bool {
+	if other.lo != nil {
+		if iv.lo == nil {
+			return false
+		}
+		if c := compareNumbers(*iv.lo, *other.lo); c < 0 || (c == 0 && iv.loIncl && !other.loIncl) {
+			return false
+		}
+	}
+	if other.hi != nil {
+		if iv.hi == nil {
+			return false
+		}
+		if c := compareNumbers(*iv.hi, *other.hi); c > 0 || (c == 0 && iv.hiIncl && !other.hiIncl) {
+			return false
+		}
+	}
+	return true
+}
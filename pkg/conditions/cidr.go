@@ -37,6 +37,10 @@ func (s *CIDRSpec) String() string {
 	return fmt.Sprintf("[%s] IN CIDR RANGE %+v", s.Key, s.Value)
 }
 
+func (s *CIDRSpec) ContextKeys() []string {
+	return []string{s.Key}
+}
+
 func (s *CIDRSpec) Evaluate(v map[string]any) (bool, error) {
 	if val, found := maputils.RecursiveGet(s.Key, v); found {
 		if val, ok := val.(string); ok {
@@ -2,28 +2,62 @@ package conditions
 
 import (
 	"fmt"
-	"reflect"
 
 	"github.com/raphaelreyna/policyauthor"
 	"github.com/raphaelreyna/policyauthor/pkg/maputils"
+	"gopkg.in/yaml.v3"
 )
 
+// EqualSpec matches when the value at Key equals Value.
+//
+// Numbers are equal when their values are, regardless of their Go type, so 8080 equals int64(8080),
+// float64(8080) and json.Number("8080"). Maps and lists are compared element by element under the same rules.
+// Strings are compared case insensitively when CaseInsensitive is set,
+// and may equal the bools and numbers they spell ("true", "8080") when Coerce is set.
 type EqualSpec struct {
-	Key   string `yaml:"key"`
-	Value any    `yaml:"value"`
+	Key             string `yaml:"key"`
+	Value           any    `yaml:"value"`
+	CaseInsensitive bool   `yaml:"caseInsensitive"`
+	Coerce          bool   `yaml:"coerce"`
+
+	// scalar holds the precomputed key of Value when it is a scalar.
+	scalar   any  `yaml:"-"`
+	isScalar bool `yaml:"-"`
+}
+
+func (s *EqualSpec) UnmarshalYAML(value *yaml.Node) error {
+	type T EqualSpec
+	var t T
+	if err := value.Decode(&t); err != nil {
+		return err
+	}
+	*s = EqualSpec(t)
+
+	if k, err := scalarKey(s.Value, s.CaseInsensitive); err == nil {
+		s.scalar, s.isScalar = k, true
+	}
+
+	return nil
 }
 
 func (s *EqualSpec) String() string {
 	return fmt.Sprintf("[%s] EQUALS %+v", s.Key, s.Value)
 }
 
+func (s *EqualSpec) ContextKeys() []string {
+	return []string{s.Key}
+}
+
 func (s *EqualSpec) Evaluate(v map[string]any) (bool, error) {
 	vv, found := maputils.RecursiveGet(s.Key, v)
 	if !found {
 		return false, policyauthor.NewKeyNotFoundError(s.Key)
 	}
 
-	// TODO(raphaelreyna): performance could probably be improved here
+	if s.isScalar && !s.Coerce {
+		k, err := scalarKey(vv, s.CaseInsensitive)
+		return err == nil && k == s.scalar, nil
+	}
 
-	return reflect.DeepEqual(vv, s.Value), nil
+	return equalValues(vv, s.Value, equalOptions{foldCase: s.CaseInsensitive, coerce: s.Coerce}), nil
 }
@@ -14,6 +14,10 @@ func (s *ExistsSpec) String() string {
 	return fmt.Sprintf("[%s] EXISTS", s.Key)
 }
 
+func (s *ExistsSpec) ContextKeys() []string {
+	return []string{s.Key}
+}
+
 func (s *ExistsSpec) Evaluate(v map[string]interface{}) (bool, error) {
 	_, found := maputils.RecursiveGet(s.Key, v)
 	return found, nil
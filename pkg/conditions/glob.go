@@ -0,0 +1,191 @@
+package conditions
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/raphaelreyna/policyauthor"
+	"github.com/raphaelreyna/policyauthor/pkg/maputils"
+	"github.com/raphaelreyna/policyauthor/pkg/regexutils"
+	"gopkg.in/yaml.v3"
+)
+
+// GlobSpec matches when the string at Key matches a wildcard Pattern.
+//
+// Style selects the segment separator: "path" (the default) uses '/' and "host" uses '.'.
+// Within a pattern, '*' matches within a single segment (a whole segment '*' must be non-empty),
+// '?' matches a single character within a segment, and a whole segment '**' matches zero or more segments.
+// A backslash escapes the following character.
+//
+// Each wildcard is captured, numbered from left to right, and may be referenced in Return as \1, \2, etc.
+type GlobSpec struct {
+	Key             string `yaml:"key"`
+	Pattern         string `yaml:"pattern"`
+	Style           string `yaml:"style"`
+	CaseInsensitive bool   `yaml:"caseInsensitive"`
+	Return          string `yaml:"return"`
+
+	r *regexp.Regexp `yaml:"-"`
+}
+
+func (s *GlobSpec) UnmarshalYAML(value *yaml.Node) error {
+	type S GlobSpec
+
+	obj := S{}
+	if err := value.Decode(&obj); err != nil {
+		return err
+	}
+	*s = GlobSpec(obj)
+
+	if s.Pattern == "" {
+		return fmt.Errorf("GlobSpec error: pattern must be set")
+	}
+
+	var sep byte
+	switch s.Style {
+	case "", "path":
+		sep = '/'
+	case "host":
+		sep = '.'
+	default:
+		return fmt.Errorf("GlobSpec error: unknown style %q", s.Style)
+	}
+
+	expr, err := globToRegex(s.Pattern, sep)
+	if err != nil {
+		return fmt.Errorf("GlobSpec error: %s", err)
+	}
+	if s.CaseInsensitive {
+		expr = "(?i)" + expr
+	}
+
+	if s.r, err = regexp.Compile(expr); err != nil {
+		return fmt.Errorf("GlobSpec error: %s", err)
+	}
+
+	return nil
+}
+
+func (s *GlobSpec) String() string {
+	return fmt.Sprintf("[%s] MATCHES GLOB %+v", s.Key, s.Pattern)
+}
+
+func (s *GlobSpec) ContextKeys() []string {
+	return []string{s.Key}
+}
+
+func (s *GlobSpec) Evaluate(v map[string]any) (bool, error) {
+	if val, found := maputils.RecursiveGet(s.Key, v); found {
+		if val, ok := val.(string); ok {
+			return s.r.MatchString(val), nil
+		}
+
+		return false, fmt.Errorf("key %s is not a string", s.Key)
+	}
+	return false, policyauthor.NewKeyNotFoundError(s.Key)
+}
+
+func (s *GlobSpec) ValueReturnEnabled() bool {
+	return s.Return != ""
+}
+
+func (s *GlobSpec) EvaluateWithReturnValue(v map[string]any) (any, bool, error) {
+	if val, found := maputils.RecursiveGet(s.Key, v); found {
+		val, ok := val.(string)
+		if !ok {
+			return nil, false, fmt.Errorf("key %s is not a string", s.Key)
+		}
+
+		if !s.r.MatchString(val) {
+			return nil, false, nil
+		}
+
+		return regexutils.Format(s.r, val, s.Return), true, nil
+	}
+	return nil, false, policyauthor.NewKeyNotFoundError(s.Key)
+}
+
+// globToRegex translates a glob pattern with the given segment separator into an anchored regular expression.
+func globToRegex(pattern string, sep byte) (string, error) {
+	var (
+		qsep  = regexp.QuoteMeta(string(sep))
+		other = "[^" + qsep + "]"
+		b     strings.Builder
+	)
+
+	segs, err := splitSegments(pattern, sep)
+	if err != nil {
+		return "", err
+	}
+
+	b.WriteString("^")
+	for i, seg := range segs {
+		prevRecursive := i > 0 && segs[i-1] == "**"
+
+		if seg == "**" {
+			switch {
+			case len(segs) == 1:
+				b.WriteString("(.*)")
+			case i == len(segs)-1:
+				b.WriteString("(?:" + qsep + "(.*))?")
+			default:
+				if i > 0 && !prevRecursive {
+					b.WriteString(qsep)
+				}
+				b.WriteString("(?:(.*)" + qsep + ")?")
+			}
+			continue
+		}
+
+		if i > 0 && !prevRecursive {
+			b.WriteString(qsep)
+		}
+
+		if seg == "*" {
+			b.WriteString("(" + other + "+)")
+			continue
+		}
+
+		escaped := false
+		for _, c := range seg {
+			switch {
+			case escaped:
+				b.WriteString(regexp.QuoteMeta(string(c)))
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '*':
+				b.WriteString("(" + other + "*)")
+			case c == '?':
+				b.WriteString("(" + other + ")")
+			default:
+				b.WriteString(regexp.QuoteMeta(string(c)))
+			}
+		}
+	}
+	b.WriteString("$")
+
+	return b.String(), nil
+}
+
+// splitSegments splits pattern at each separator that is not escaped, keeping the escapes in the segments.
+func splitSegments(pattern string, sep byte) ([]string, error) {
+	var (
+		segs  []string
+		start int
+	)
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			if i == len(pattern)-1 {
+				return nil, fmt.Errorf("pattern %q has an unfinished escape", pattern)
+			}
+			i++
+		case sep:
+			segs = append(segs, pattern[start:i])
+			start = i + 1
+		}
+	}
+	return append(segs, pattern[start:]), nil
+}
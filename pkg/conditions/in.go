@@ -0,0 +1,101 @@
+package conditions
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/raphaelreyna/policyauthor"
+	"github.com/raphaelreyna/policyauthor/pkg/maputils"
+	"gopkg.in/yaml.v3"
+)
+
+// InSpec matches when the value at Key is one of Values.
+// Values may also be loaded from a YAML or JSON list in the file at ValuesFrom.
+//
+// Numbers match regardless of their Go type, so 1 matches int64(1) and float64(1).
+// Strings are compared case insensitively when CaseInsensitive is set.
+type InSpec struct {
+	Key             string `yaml:"key"`
+	Values          []any  `yaml:"values"`
+	ValuesFrom      string `yaml:"valuesFrom"`
+	CaseInsensitive bool   `yaml:"caseInsensitive"`
+
+	set map[any]struct{} `yaml:"-"`
+}
+
+func (s *InSpec) UnmarshalYAML(value *yaml.Node) error {
+	type T InSpec
+	var t T
+	if err := value.Decode(&t); err != nil {
+		return err
+	}
+	*s = InSpec(t)
+
+	if s.ValuesFrom != "" {
+		b, err := os.ReadFile(s.ValuesFrom)
+		if err != nil {
+			return fmt.Errorf("InSpec error: could not read values file: %s", err)
+		}
+
+		var values []any
+		if err := yaml.Unmarshal(b, &values); err != nil {
+			return fmt.Errorf("InSpec error: could not parse values file %s: %s", s.ValuesFrom, err)
+		}
+		s.Values = append(s.Values, values...)
+	}
+
+	if len(s.Values) == 0 {
+		return fmt.Errorf("InSpec error: no values set")
+	}
+
+	s.set = make(map[any]struct{}, len(s.Values))
+	for _, v := range s.Values {
+		k, err := scalarKey(v, s.CaseInsensitive)
+		if err != nil {
+			return fmt.Errorf("InSpec error: invalid value %v: %s", v, err)
+		}
+		s.set[k] = struct{}{}
+	}
+
+	return nil
+}
+
+func (s *InSpec) String() string {
+	return fmt.Sprintf("[%s] IN %+v", s.Key, s.Values)
+}
+
+func (s *InSpec) ContextKeys() []string {
+	return []string{s.Key}
+}
+
+func (s *InSpec) Evaluate(v map[string]any) (bool, error) {
+	val, found := maputils.RecursiveGet(s.Key, v)
+	if !found {
+		return false, policyauthor.NewKeyNotFoundError(s.Key)
+	}
+
+	k, err := scalarKey(val, s.CaseInsensitive)
+	if err != nil {
+		return false, fmt.Errorf("InSpec error: value at key %s: %s", s.Key, err)
+	}
+
+	_, ok := s.set[k]
+	return ok, nil
+}
+
+// NotInSpec matches when the value at Key is none of Values.
+type NotInSpec struct {
+	InSpec `yaml:",inline"`
+}
+
+func (s *NotInSpec) String() string {
+	return fmt.Sprintf("[%s] NOT IN %+v", s.Key, s.Values)
+}
+
+func (s *NotInSpec) Evaluate(v map[string]any) (bool, error) {
+	hit, err := s.InSpec.Evaluate(v)
+	if err != nil {
+		return false, err
+	}
+	return !hit, nil
+}
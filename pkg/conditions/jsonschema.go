@@ -0,0 +1,462 @@
+package conditions
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"unicode/utf8"
+
+	"github.com/raphaelreyna/policyauthor"
+	"github.com/raphaelreyna/policyauthor/pkg/maputils"
+	"gopkg.in/yaml.v3"
+)
+
+// JSONSchemaSpec matches when the value at Key, or the whole evaluation context when Key is empty,
+// is valid against a JSON Schema given inline with Schema or loaded from the JSON or YAML file at SchemaFrom.
+//
+// A pragmatic subset of draft 2020-12 is supported: boolean schemas, type, enum, const, properties, required,
+// additionalProperties, minProperties, maxProperties, items, minItems, maxItems, uniqueItems, pattern,
+// minLength, maxLength, minimum, maximum, exclusiveMinimum, exclusiveMaximum, multipleOf, allOf, anyOf, oneOf and not.
+// Other keywords are ignored.
+type JSONSchemaSpec struct {
+	Key        string `yaml:"key"`
+	Schema     any    `yaml:"schema"`
+	SchemaFrom string `yaml:"schemaFrom"`
+
+	schema *jsonSchema `yaml:"-"`
+}
+
+func (s *JSONSchemaSpec) UnmarshalYAML(value *yaml.Node) error {
+	type T JSONSchemaSpec
+	var t T
+	if err := value.Decode(&t); err != nil {
+		return err
+	}
+	*s = JSONSchemaSpec(t)
+
+	switch {
+	case s.Schema != nil && s.SchemaFrom != "":
+		return fmt.Errorf("JSONSchemaSpec error: cannot have both schema and schemaFrom")
+	case s.SchemaFrom != "":
+		b, err := os.ReadFile(s.SchemaFrom)
+		if err != nil {
+			return fmt.Errorf("JSONSchemaSpec error: could not read schema file: %s", err)
+		}
+		// JSON is valid YAML.
+		if err := yaml.Unmarshal(b, &s.Schema); err != nil {
+			return fmt.Errorf("JSONSchemaSpec error: could not parse schema file %s: %s", s.SchemaFrom, err)
+		}
+	case s.Schema == nil:
+		return fmt.Errorf("JSONSchemaSpec error: one of schema or schemaFrom must be set")
+	}
+
+	var err error
+	if s.schema, err = compileJSONSchema(s.Schema, "#"); err != nil {
+		return fmt.Errorf("JSONSchemaSpec error: %s", err)
+	}
+
+	return nil
+}
+
+func (s *JSONSchemaSpec) String() string {
+	key := s.Key
+	if key == "" {
+		key = "."
+	}
+	if s.SchemaFrom != "" {
+		return fmt.Sprintf("[%s] MATCHES SCHEMA %s", key, s.SchemaFrom)
+	}
+	return fmt.Sprintf("[%s] MATCHES SCHEMA", key)
+}
+
+func (s *JSONSchemaSpec) ContextKeys() []string {
+	return []string{s.Key}
+}
+
+func (s *JSONSchemaSpec) Evaluate(v map[string]any) (bool, error) {
+	var val any = v
+	if s.Key != "" {
+		var found bool
+		if val, found = maputils.RecursiveGet(s.Key, v); !found {
+			return false, policyauthor.NewKeyNotFoundError(s.Key)
+		}
+	}
+
+	return s.schema.validate(val), nil
+}
+
+type jsonSchema struct {
+	// always is set for the boolean schemas true and false.
+	always *bool
+
+	types []string
+	enum  []any
+	cnst  *any
+
+	properties           map[string]*jsonSchema
+	required             []string
+	additionalProperties *jsonSchema
+	minProperties        *int
+	maxProperties        *int
+
+	items       *jsonSchema
+	minItems    *int
+	maxItems    *int
+	uniqueItems bool
+
+	pattern   *regexp.Regexp
+	minLength *int
+	maxLength *int
+
+	minimum          *Number
+	maximum          *Number
+	exclusiveMinimum *Number
+	exclusiveMaximum *Number
+	multipleOf       *big.Rat
+
+	allOf []*jsonSchema
+	anyOf []*jsonSchema
+	oneOf []*jsonSchema
+	not   *jsonSchema
+}
+
+func compileJSONSchema(v any, path string) (*jsonSchema, error) {
+	if b, ok := v.(bool); ok {
+		return &jsonSchema{always: &b}, nil
+	}
+
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: schema must be an object or a boolean, got %T", path, v)
+	}
+
+	var (
+		s   jsonSchema
+		err error
+	)
+
+	switch t := m["type"].(type) {
+	case nil:
+	case string:
+		s.types = []string{t}
+	case []any:
+		for _, x := range t {
+			str, ok := x.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s/type: expected strings, got %T", path, x)
+			}
+			s.types = append(s.types, str)
+		}
+	default:
+		return nil, fmt.Errorf("%s/type: expected a string or list of strings, got %T", path, t)
+	}
+	for _, t := range s.types {
+		switch t {
+		case "null", "boolean", "object", "array", "number", "integer", "string":
+		default:
+			return nil, fmt.Errorf("%s/type: unknown type %q", path, t)
+		}
+	}
+
+	if e, ok := m["enum"]; ok {
+		if s.enum, ok = e.([]any); !ok {
+			return nil, fmt.Errorf("%s/enum: expected a list, got %T", path, e)
+		}
+	}
+	if c, ok := m["const"]; ok {
+		s.cnst = &c
+	}
+
+	if props, ok := m["properties"]; ok {
+		pm, ok := props.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s/properties: expected an object, got %T", path, props)
+		}
+		s.properties = make(map[string]*jsonSchema, len(pm))
+		for name, sub := range pm {
+			if s.properties[name], err = compileJSONSchema(sub, path+"/properties/"+name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if req, ok := m["required"]; ok {
+		list, ok := req.([]any)
+		if !ok {
+			return nil, fmt.Errorf("%s/required: expected a list, got %T", path, req)
+		}
+		for _, x := range list {
+			str, ok := x.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s/required: expected strings, got %T", path, x)
+			}
+			s.required = append(s.required, str)
+		}
+	}
+	if s.additionalProperties, err = compileSubschema(m, "additionalProperties", path); err != nil {
+		return nil, err
+	}
+	if s.items, err = compileSubschema(m, "items", path); err != nil {
+		return nil, err
+	}
+	if s.not, err = compileSubschema(m, "not", path); err != nil {
+		return nil, err
+	}
+
+	for kw, dst := range map[string]*[]*jsonSchema{"allOf": &s.allOf, "anyOf": &s.anyOf, "oneOf": &s.oneOf} {
+		x, ok := m[kw]
+		if !ok {
+			continue
+		}
+		list, ok := x.([]any)
+		if !ok || len(list) == 0 {
+			return nil, fmt.Errorf("%s/%s: expected a non-empty list", path, kw)
+		}
+		for i, sub := range list {
+			c, err := compileJSONSchema(sub, fmt.Sprintf("%s/%s/%d", path, kw, i))
+			if err != nil {
+				return nil, err
+			}
+			*dst = append(*dst, c)
+		}
+	}
+
+	for kw, dst := range map[string]**int{
+		"minProperties": &s.minProperties, "maxProperties": &s.maxProperties,
+		"minItems": &s.minItems, "maxItems": &s.maxItems,
+		"minLength": &s.minLength, "maxLength": &s.maxLength,
+	} {
+		x, ok := m[kw]
+		if !ok {
+			continue
+		}
+		n, ok := toNumber(x, false)
+		if !ok || n.normalize().kind != uintNumber {
+			return nil, fmt.Errorf("%s/%s: expected a non-negative integer, got %v", path, kw, x)
+		}
+		i := int(n.normalize().u)
+		*dst = &i
+	}
+
+	for kw, dst := range map[string]**Number{
+		"minimum": &s.minimum, "maximum": &s.maximum,
+		"exclusiveMinimum": &s.exclusiveMinimum, "exclusiveMaximum": &s.exclusiveMaximum,
+	} {
+		x, ok := m[kw]
+		if !ok {
+			continue
+		}
+		n, ok := toNumber(x, false)
+		if !ok {
+			return nil, fmt.Errorf("%s/%s: expected a number, got %v", path, kw, x)
+		}
+		*dst = &n
+	}
+
+	if x, ok := m["multipleOf"]; ok {
+		n, ok := toNumber(x, false)
+		if !ok || n.Float64() <= 0 {
+			return nil, fmt.Errorf("%s/multipleOf: expected a positive number, got %v", path, x)
+		}
+		if s.multipleOf, ok = decimalRat(n); !ok {
+			return nil, fmt.Errorf("%s/multipleOf: expected a finite number, got %v", path, x)
+		}
+	}
+
+	if x, ok := m["uniqueItems"]; ok {
+		if s.uniqueItems, ok = x.(bool); !ok {
+			return nil, fmt.Errorf("%s/uniqueItems: expected a boolean, got %T", path, x)
+		}
+	}
+
+	if x, ok := m["pattern"]; ok {
+		str, ok := x.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s/pattern: expected a string, got %T", path, x)
+		}
+		if s.pattern, err = regexp.Compile(str); err != nil {
+			return nil, fmt.Errorf("%s/pattern: %s", path, err)
+		}
+	}
+
+	return &s, nil
+}
+
+func compileSubschema(m map[string]any, kw, path string) (*jsonSchema, error) {
+	x, ok := m[kw]
+	if !ok {
+		return nil, nil
+	}
+	return compileJSONSchema(x, path+"/"+kw)
+}
+
+func (s *jsonSchema) validate(val any) bool {
+	if s.always != nil {
+		return *s.always
+	}
+
+	if len(s.types) > 0 && !slices.ContainsFunc(s.types, func(t string) bool { return jsonTypeMatches(t, val) }) {
+		return false
+	}
+	if s.enum != nil && !slices.ContainsFunc(s.enum, func(e any) bool { return equalValues(val, e, equalOptions{}) }) {
+		return false
+	}
+	if s.cnst != nil && !equalValues(val, *s.cnst, equalOptions{}) {
+		return false
+	}
+
+	// json.Number is a string kind, so numbers are told apart first.
+	n, isNumber := toNumber(val, false)
+	switch rv := reflect.ValueOf(val); {
+	case isNumber:
+		if !s.validateNumber(n) {
+			return false
+		}
+	case rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String:
+		if !s.validateObject(rv) {
+			return false
+		}
+	case isList(rv):
+		if !s.validateArray(rv) {
+			return false
+		}
+	case rv.Kind() == reflect.String:
+		if !s.validateString(rv.String()) {
+			return false
+		}
+	}
+
+	for _, sub := range s.allOf {
+		if !sub.validate(val) {
+			return false
+		}
+	}
+	if s.anyOf != nil && !slices.ContainsFunc(s.anyOf, func(sub *jsonSchema) bool { return sub.validate(val) }) {
+		return false
+	}
+	if s.oneOf != nil {
+		matches := 0
+		for _, sub := range s.oneOf {
+			if sub.validate(val) {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return false
+		}
+	}
+	if s.not != nil && s.not.validate(val) {
+		return false
+	}
+
+	return true
+}
+
+func (s *jsonSchema) validateObject(rv reflect.Value) bool {
+	n := rv.Len()
+	if (s.minProperties != nil && n < *s.minProperties) || (s.maxProperties != nil && n > *s.maxProperties) {
+		return false
+	}
+
+	for _, name := range s.required {
+		if !rv.MapIndex(reflect.ValueOf(name).Convert(rv.Type().Key())).IsValid() {
+			return false
+		}
+	}
+
+	iter := rv.MapRange()
+	for iter.Next() {
+		name, val := iter.Key().String(), iter.Value().Interface()
+		if sub, ok := s.properties[name]; ok {
+			if !sub.validate(val) {
+				return false
+			}
+		} else if s.additionalProperties != nil && !s.additionalProperties.validate(val) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *jsonSchema) validateArray(rv reflect.Value) bool {
+	n := rv.Len()
+	if (s.minItems != nil && n < *s.minItems) || (s.maxItems != nil && n > *s.maxItems) {
+		return false
+	}
+
+	for i := 0; i < n; i++ {
+		item := rv.Index(i).Interface()
+		if s.items != nil && !s.items.validate(item) {
+			return false
+		}
+		if s.uniqueItems {
+			for j := 0; j < i; j++ {
+				if equalValues(item, rv.Index(j).Interface(), equalOptions{}) {
+					return false
+				}
+			}
+		}
+	}
+
+	return true
+}
+
+func (s *jsonSchema) validateString(str string) bool {
+	if s.minLength != nil || s.maxLength != nil {
+		n := utf8.RuneCountInString(str)
+		if (s.minLength != nil && n < *s.minLength) || (s.maxLength != nil && n > *s.maxLength) {
+			return false
+		}
+	}
+	return s.pattern == nil || s.pattern.MatchString(str)
+}
+
+func (s *jsonSchema) validateNumber(n Number) bool {
+	switch {
+	case s.minimum != nil && compareNumbers(n, *s.minimum) < 0:
+		return false
+	case s.maximum != nil && compareNumbers(n, *s.maximum) > 0:
+		return false
+	case s.exclusiveMinimum != nil && compareNumbers(n, *s.exclusiveMinimum) <= 0:
+		return false
+	case s.exclusiveMaximum != nil && compareNumbers(n, *s.exclusiveMaximum) >= 0:
+		return false
+	}
+
+	if s.multipleOf != nil {
+		r, ok := decimalRat(n)
+		if !ok || !r.Quo(r, s.multipleOf).IsInt() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// jsonTypeMatches reports whether val is an instance of the JSON Schema type t.
+func jsonTypeMatches(t string, val any) bool {
+	switch t {
+	case "integer":
+		n, ok := toNumber(val, false)
+		return ok && n.normalize().kind != floatNumber
+	case "boolean":
+		return typeName(val) == "bool"
+	case "object":
+		rv := reflect.ValueOf(val)
+		return rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String
+	case "array":
+		return typeName(val) == "list"
+	default:
+		// null, number and string share their names with TypeSpec.
+		return typeName(val) == t
+	}
+}
+
+// decimalRat returns the exact value of the shortest decimal representation of n,
+// so that 0.3 is a multiple of 0.1 although their float64 approximations are not.
+func decimalRat(n Number) (*big.Rat, bool) {
+	return new(big.Rat).SetString(n.String())
+}
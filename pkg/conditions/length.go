@@ -0,0 +1,80 @@
+package conditions
+
+import (
+	"fmt"
+	"reflect"
+	"unicode/utf8"
+
+	"github.com/raphaelreyna/policyauthor"
+	"github.com/raphaelreyna/policyauthor/pkg/maputils"
+	"gopkg.in/yaml.v3"
+)
+
+// LengthSpec matches when the length of the value at Key is within Min and Max, inclusive.
+// Strings are measured in runes, or in bytes when Unit is "bytes"; lists and maps by their number of elements.
+type LengthSpec struct {
+	Key  string `yaml:"key"`
+	Min  *int   `yaml:"min"`
+	Max  *int   `yaml:"max"`
+	Unit string `yaml:"unit"`
+}
+
+func (s *LengthSpec) UnmarshalYAML(value *yaml.Node) error {
+	type T LengthSpec
+	var t T
+	if err := value.Decode(&t); err != nil {
+		return err
+	}
+	*s = LengthSpec(t)
+
+	if s.Min == nil && s.Max == nil {
+		return fmt.Errorf("LengthSpec error: at least one of min or max must be set")
+	}
+
+	switch s.Unit {
+	case "", "runes", "bytes":
+	default:
+		return fmt.Errorf("LengthSpec error: unknown unit %q", s.Unit)
+	}
+
+	return nil
+}
+
+func (s *LengthSpec) String() string {
+	return fmt.Sprintf("LENGTH [%s] BETWEEN %s AND %s", s.Key, fmtBound(s.Min), fmtBound(s.Max))
+}
+
+func (s *LengthSpec) ContextKeys() []string {
+	return []string{s.Key}
+}
+
+func (s *LengthSpec) Evaluate(v map[string]any) (bool, error) {
+	val, found := maputils.RecursiveGet(s.Key, v)
+	if !found {
+		return false, policyauthor.NewKeyNotFoundError(s.Key)
+	}
+
+	var n int
+	if str, ok := val.(string); ok {
+		if s.Unit == "bytes" {
+			n = len(str)
+		} else {
+			n = utf8.RuneCountInString(str)
+		}
+	} else {
+		switch rv := reflect.ValueOf(val); rv.Kind() {
+		case reflect.Slice, reflect.Array, reflect.Map:
+			n = rv.Len()
+		default:
+			return false, fmt.Errorf("LengthSpec error: value at key %s has no length, got %T", s.Key, val)
+		}
+	}
+
+	if s.Min != nil && n < *s.Min {
+		return false, nil
+	}
+	if s.Max != nil && n > *s.Max {
+		return false, nil
+	}
+	return true, nil
+}
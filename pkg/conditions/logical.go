@@ -5,10 +5,61 @@ import (
 	"strings"
 
 	"github.com/raphaelreyna/policyauthor"
+	"gopkg.in/yaml.v3"
 )
 
+// AndSpec matches when all of Conditions match, evaluating them in order until one does not.
+//
+// When Adaptive is set, the conditions are instead evaluated in an order learned from previous evaluations,
+// recomputed every ReorderEvery evaluations (1000 by default), so that cheap conditions that often do not match come first.
+// Adaptive conditions must not return values and must be free of side effects, as they may be evaluated in any order or not at all.
+// Conditions keeping state across evaluations, those implementing policyauthor.Stateful such as ratelimit, are rejected.
+// Statistics are halved on each reordering, so that the order follows recent evaluations.
+// As conditions that are not reached are not evaluated, an evaluation that would fail on one of them
+// in the declared order may no longer fail, and conversely.
 type AndSpec struct {
-	Conditions []*policyauthor.Condition `yaml:"conditions"`
+	Conditions   []*policyauthor.Condition `yaml:"conditions"`
+	Adaptive     bool                      `yaml:"adaptive"`
+	ReorderEvery int                       `yaml:"reorderEvery"`
+
+	adaptive *adaptiveOrder `yaml:"-"`
+}
+
+func (s *AndSpec) UnmarshalYAML(value *yaml.Node) error {
+	type T AndSpec
+	var t T
+	if err := value.Decode(&t); err != nil {
+		return err
+	}
+	*s = AndSpec(t)
+
+	if s.Adaptive {
+		a, err := newAdaptiveOrder(s.Conditions, false, s.ReorderEvery)
+		if err != nil {
+			return fmt.Errorf("AndSpec error: %s", err)
+		}
+		s.adaptive = a
+	}
+
+	return nil
+}
+
+// EvaluationOrder returns Conditions in the order they are evaluated in.
+func (s *AndSpec) EvaluationOrder() []*policyauthor.Condition {
+	return s.adaptive.evaluationOrder(s.Conditions)
+}
+
+// ChildStats returns the recent statistics of Conditions, in declared order,
+// or nil if the condition is not adaptive.
+func (s *AndSpec) ChildStats() []ChildStats {
+	return s.adaptive.allChildStats()
+}
+
+// ResetOrder restores the declared order of adaptive conditions and discards the statistics it was learned from.
+func (s *AndSpec) ResetOrder() {
+	if s.adaptive != nil {
+		s.adaptive.reset(len(s.Conditions))
+	}
 }
 
 func (s *AndSpec) String() string {
@@ -21,9 +72,21 @@ func (s *AndSpec) String() string {
 	return b.String()
 }
 
+func (s *AndSpec) ContextKeys() []string {
+	return nil
+}
+
+func (s *AndSpec) Children() []*policyauthor.Condition {
+	return s.Conditions
+}
+
 func (s *AndSpec) Evaluate(v map[string]any) (bool, error) {
+	if s.adaptive != nil {
+		return s.adaptive.evaluate(s.Conditions, v)
+	}
+
 	for _, c := range s.Conditions {
-		hit, err := c.Spec.Evaluate(v)
+		hit, err := c.Evaluate(v)
 		if err != nil {
 			return false, err
 		}
@@ -56,7 +119,7 @@ func (s *AndSpec) EvaluateWithReturnValue(v map[string]any) (any, bool, error) {
 			if vr, ok := c.Spec.(policyauthor.ValueReturner); ok {
 				if vr.ValueReturnEnabled() {
 					var err error
-					v, hit, err := vr.EvaluateWithReturnValue(v)
+					v, hit, err := c.EvaluateWithReturnValue(v)
 					if err != nil {
 						return nil, false, err
 					}
@@ -66,7 +129,7 @@ func (s *AndSpec) EvaluateWithReturnValue(v map[string]any) (any, bool, error) {
 					val = v
 					foundVal = true
 				} else {
-					hit, err := c.Spec.Evaluate(v)
+					hit, err := c.Evaluate(v)
 					if err != nil {
 						return nil, false, err
 					}
@@ -75,7 +138,7 @@ func (s *AndSpec) EvaluateWithReturnValue(v map[string]any) (any, bool, error) {
 					}
 				}
 			} else {
-				hit, err := c.Spec.Evaluate(v)
+				hit, err := c.Evaluate(v)
 				if err != nil {
 					return nil, false, err
 				}
@@ -88,8 +151,52 @@ func (s *AndSpec) EvaluateWithReturnValue(v map[string]any) (any, bool, error) {
 	return val, true, nil
 }
 
+// OrSpec matches when any of Conditions matches, evaluating them in order until one does.
+//
+// Adaptive and ReorderEvery are those of AndSpec, moving ahead cheap conditions that often match.
 type OrSpec struct {
-	Conditions []*policyauthor.Condition `yaml:"conditions"`
+	Conditions   []*policyauthor.Condition `yaml:"conditions"`
+	Adaptive     bool                      `yaml:"adaptive"`
+	ReorderEvery int                       `yaml:"reorderEvery"`
+
+	adaptive *adaptiveOrder `yaml:"-"`
+}
+
+func (s *OrSpec) UnmarshalYAML(value *yaml.Node) error {
+	type T OrSpec
+	var t T
+	if err := value.Decode(&t); err != nil {
+		return err
+	}
+	*s = OrSpec(t)
+
+	if s.Adaptive {
+		a, err := newAdaptiveOrder(s.Conditions, true, s.ReorderEvery)
+		if err != nil {
+			return fmt.Errorf("OrSpec error: %s", err)
+		}
+		s.adaptive = a
+	}
+
+	return nil
+}
+
+// EvaluationOrder returns Conditions in the order they are evaluated in.
+func (s *OrSpec) EvaluationOrder() []*policyauthor.Condition {
+	return s.adaptive.evaluationOrder(s.Conditions)
+}
+
+// ChildStats returns the recent statistics of Conditions, in declared order,
+// or nil if the condition is not adaptive.
+func (s *OrSpec) ChildStats() []ChildStats {
+	return s.adaptive.allChildStats()
+}
+
+// ResetOrder restores the declared order of adaptive conditions and discards the statistics it was learned from.
+func (s *OrSpec) ResetOrder() {
+	if s.adaptive != nil {
+		s.adaptive.reset(len(s.Conditions))
+	}
 }
 
 func (s *OrSpec) String() string {
@@ -102,9 +209,21 @@ func (s *OrSpec) String() string {
 	return b.String()
 }
 
+func (s *OrSpec) ContextKeys() []string {
+	return nil
+}
+
+func (s *OrSpec) Children() []*policyauthor.Condition {
+	return s.Conditions
+}
+
 func (s *OrSpec) Evaluate(v map[string]any) (bool, error) {
+	if s.adaptive != nil {
+		return s.adaptive.evaluate(s.Conditions, v)
+	}
+
 	for _, c := range s.Conditions {
-		hit, err := c.Spec.Evaluate(v)
+		hit, err := c.Evaluate(v)
 		if err != nil {
 			return false, err
 		}
@@ -131,7 +250,7 @@ func (s *OrSpec) EvaluateWithReturnValue(v map[string]any) (any, bool, error) {
 		if vr, ok := c.Spec.(policyauthor.ValueReturner); ok {
 			if vr.ValueReturnEnabled() {
 				var err error
-				v, hit, err := vr.EvaluateWithReturnValue(v)
+				v, hit, err := c.EvaluateWithReturnValue(v)
 				if err != nil {
 					return nil, false, err
 				}
@@ -139,7 +258,7 @@ func (s *OrSpec) EvaluateWithReturnValue(v map[string]any) (any, bool, error) {
 					return v, true, nil
 				}
 			} else {
-				hit, err := c.Spec.Evaluate(v)
+				hit, err := c.Evaluate(v)
 				if err != nil {
 					return nil, false, err
 				}
@@ -148,7 +267,7 @@ func (s *OrSpec) EvaluateWithReturnValue(v map[string]any) (any, bool, error) {
 				}
 			}
 		} else {
-			hit, err := c.Spec.Evaluate(v)
+			hit, err := c.Evaluate(v)
 			if err != nil {
 				return nil, false, err
 			}
@@ -165,11 +284,19 @@ type NotSpec struct {
 }
 
 func (s *NotSpec) String() string {
-	return fmt.Sprintf("NOT (%s)", s.Condition)
+	return fmt.Sprintf("NOT (%s)", &s.Condition)
+}
+
+func (s *NotSpec) ContextKeys() []string {
+	return nil
+}
+
+func (s *NotSpec) Children() []*policyauthor.Condition {
+	return []*policyauthor.Condition{&s.Condition}
 }
 
 func (s *NotSpec) Evaluate(v map[string]any) (bool, error) {
-	hit, err := s.Condition.Spec.Evaluate(v)
+	hit, err := s.Condition.Evaluate(v)
 	if err != nil {
 		return false, err
 	}
@@ -186,20 +313,20 @@ func (s *NotSpec) ValueReturnEnabled() bool {
 func (s *NotSpec) EvaluateWithReturnValue(v map[string]any) (any, bool, error) {
 	if vr, ok := s.Condition.Spec.(policyauthor.ValueReturner); ok {
 		if vr.ValueReturnEnabled() {
-			v, hit, err := vr.EvaluateWithReturnValue(v)
+			v, hit, err := s.Condition.EvaluateWithReturnValue(v)
 			if err != nil {
 				return nil, false, err
 			}
 			return v, !hit, nil
 		} else {
-			hit, err := s.Condition.Spec.Evaluate(v)
+			hit, err := s.Condition.Evaluate(v)
 			if err != nil {
 				return nil, false, err
 			}
 			return policyauthor.ValueReturnerNil{}, !hit, nil
 		}
 	}
-	hit, err := s.Condition.Spec.Evaluate(v)
+	hit, err := s.Condition.Evaluate(v)
 	if err != nil {
 		return nil, false, err
 	}
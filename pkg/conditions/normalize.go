@@ -0,0 +1,116 @@
+package conditions
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// scalarKey returns a comparable representation of a scalar value, suitable as a map key,
+// under which numerically equal values of different Go types are identical.
+// Strings are case folded when foldCase is set.
+func scalarKey(val any, foldCase bool) (any, error) {
+	switch v := val.(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		return v, nil
+	case string:
+		if foldCase {
+			return foldString(v), nil
+		}
+		return v, nil
+	}
+
+	if n, ok := val.(Number); ok {
+		return n.normalize(), nil
+	}
+	if n, ok := toNumber(val, false); ok {
+		return n.normalize(), nil
+	}
+
+	return nil, fmt.Errorf("%T is not a scalar", val)
+}
+
+func foldString(s string) string {
+	return strings.ToLower(strings.ToUpper(s))
+}
+
+type equalOptions struct {
+	foldCase bool
+	// coerce allows strings to equal the bools and numbers they spell.
+	coerce bool
+}
+
+// equalValues reports whether a and b are equal, comparing numbers by value regardless of their Go type
+// and maps and lists element by element under the same rules.
+func equalValues(a, b any, opts equalOptions) bool {
+	ra, rb := reflect.ValueOf(a), reflect.ValueOf(b)
+
+	switch {
+	case isList(ra) && isList(rb):
+		if ra.Len() != rb.Len() {
+			return false
+		}
+		for i := 0; i < ra.Len(); i++ {
+			if !equalValues(ra.Index(i).Interface(), rb.Index(i).Interface(), opts) {
+				return false
+			}
+		}
+		return true
+	case ra.Kind() == reflect.Map && rb.Kind() == reflect.Map:
+		if ra.Len() != rb.Len() || ra.Type().Key().Kind() != reflect.String || rb.Type().Key().Kind() != reflect.String {
+			return false
+		}
+		iter := ra.MapRange()
+		for iter.Next() {
+			bv := rb.MapIndex(reflect.ValueOf(iter.Key().String()).Convert(rb.Type().Key()))
+			if !bv.IsValid() || !equalValues(iter.Value().Interface(), bv.Interface(), opts) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if opts.coerce {
+		a, b = coerceString(a, b), coerceString(b, a)
+	}
+
+	ka, err := scalarKey(a, opts.foldCase)
+	if err != nil {
+		return false
+	}
+	kb, err := scalarKey(b, opts.foldCase)
+	if err != nil {
+		return false
+	}
+	return ka == kb
+}
+
+// coerceString converts x to the type of other if x is a string and other is a bool or number.
+func coerceString(x, other any) any {
+	str, ok := x.(string)
+	if !ok {
+		return x
+	}
+
+	switch other.(type) {
+	case bool:
+		if b, err := strconv.ParseBool(str); err == nil {
+			return b
+		}
+	case string, nil:
+	default:
+		if _, ok := toNumber(other, false); ok {
+			if n, ok := parseNumber(str); ok {
+				return n
+			}
+		}
+	}
+	return x
+}
+
+func isList(rv reflect.Value) bool {
+	return rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array
+}
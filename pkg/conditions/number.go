@@ -0,0 +1,221 @@
+package conditions
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type numberKind uint8
+
+const (
+	intNumber numberKind = iota
+	uintNumber
+	floatNumber
+)
+
+// Number holds any Go numeric value without loss of precision.
+// Integers are kept as int64 or uint64 so that large values compare exactly.
+type Number struct {
+	kind numberKind
+	i    int64
+	u    uint64
+	f    float64
+}
+
+// NewNumber returns the Number holding val, a Go numeric value, json.Number or numeric string.
+func NewNumber(val any) (Number, error) {
+	n, ok := toNumber(val, true)
+	if !ok {
+		return Number{}, fmt.Errorf("%#v is not a number", val)
+	}
+	return n, nil
+}
+
+func (n *Number) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.ScalarNode {
+		return fmt.Errorf("line %d: expected a number", value.Line)
+	}
+
+	x, ok := parseNumber(value.Value)
+	if !ok {
+		return fmt.Errorf("line %d: %q is not a number", value.Line, value.Value)
+	}
+	*n = x
+
+	return nil
+}
+
+func (n Number) String() string {
+	switch n.kind {
+	case intNumber:
+		return strconv.FormatInt(n.i, 10)
+	case uintNumber:
+		return strconv.FormatUint(n.u, 10)
+	default:
+		return strconv.FormatFloat(n.f, 'g', -1, 64)
+	}
+}
+
+// Float64 returns the closest float64 to n.
+func (n Number) Float64() float64 {
+	switch n.kind {
+	case intNumber:
+		return float64(n.i)
+	case uintNumber:
+		return float64(n.u)
+	default:
+		return n.f
+	}
+}
+
+// normalize returns the canonical representation of n, so that equal values compare equal with ==.
+// Non-negative integers are stored as uint64 and integral floats as integers.
+func (n Number) normalize() Number {
+	switch n.kind {
+	case intNumber:
+		if n.i >= 0 {
+			return Number{kind: uintNumber, u: uint64(n.i)}
+		}
+	case floatNumber:
+		if n.f == math.Trunc(n.f) {
+			switch {
+			case n.f >= 0 && n.f < math.Exp2(64):
+				return Number{kind: uintNumber, u: uint64(n.f)}
+			case n.f < 0 && n.f >= -math.Exp2(63):
+				return Number{kind: intNumber, i: int64(n.f)}
+			}
+		}
+	}
+	return n
+}
+
+// parseNumber parses a decimal integer or floating point literal.
+func parseNumber(s string) (Number, bool) {
+	s = strings.TrimSpace(s)
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return Number{kind: intNumber, i: i}, true
+	}
+	if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return Number{kind: uintNumber, u: u}, true
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsNaN(f) {
+		return Number{kind: floatNumber, f: f}, true
+	}
+	return Number{}, false
+}
+
+// toNumber converts a Go numeric value or json.Number into a Number.
+// Strings are parsed as numbers only when allowStrings is true.
+func toNumber(val any, allowStrings bool) (Number, bool) {
+	switch v := val.(type) {
+	case int:
+		return Number{kind: intNumber, i: int64(v)}, true
+	case int8:
+		return Number{kind: intNumber, i: int64(v)}, true
+	case int16:
+		return Number{kind: intNumber, i: int64(v)}, true
+	case int32:
+		return Number{kind: intNumber, i: int64(v)}, true
+	case int64:
+		return Number{kind: intNumber, i: v}, true
+	case uint:
+		return Number{kind: uintNumber, u: uint64(v)}, true
+	case uint8:
+		return Number{kind: uintNumber, u: uint64(v)}, true
+	case uint16:
+		return Number{kind: uintNumber, u: uint64(v)}, true
+	case uint32:
+		return Number{kind: uintNumber, u: uint64(v)}, true
+	case uint64:
+		return Number{kind: uintNumber, u: v}, true
+	case uintptr:
+		return Number{kind: uintNumber, u: uint64(v)}, true
+	case float32:
+		if math.IsNaN(float64(v)) {
+			return Number{}, false
+		}
+		return Number{kind: floatNumber, f: float64(v)}, true
+	case float64:
+		if math.IsNaN(v) {
+			return Number{}, false
+		}
+		return Number{kind: floatNumber, f: v}, true
+	case json.Number:
+		return parseNumber(string(v))
+	case string:
+		if allowStrings {
+			return parseNumber(v)
+		}
+	}
+	return Number{}, false
+}
+
+// compareNumbers returns -1, 0 or 1 depending on whether a is less than, equal to or greater than b.
+// The comparison is exact, even between large integers and floats.
+func compareNumbers(a, b Number) int {
+	switch {
+	case a.kind == floatNumber && b.kind == floatNumber:
+		return cmp.Compare(a.f, b.f)
+	case a.kind == floatNumber:
+		return -compareNumbers(b, a)
+	case b.kind == floatNumber:
+		return compareIntFloat(a, b.f)
+	case a.kind == intNumber && b.kind == intNumber:
+		return cmp.Compare(a.i, b.i)
+	case a.kind == uintNumber && b.kind == uintNumber:
+		return cmp.Compare(a.u, b.u)
+	case a.kind == intNumber:
+		if a.i < 0 {
+			return -1
+		}
+		return cmp.Compare(uint64(a.i), b.u)
+	default:
+		if b.i < 0 {
+			return 1
+		}
+		return cmp.Compare(a.u, uint64(b.i))
+	}
+}
+
+// compareIntFloat compares an integer Number with a float without converting the integer to a float.
+func compareIntFloat(a Number, f float64) int {
+	switch {
+	case math.IsInf(f, 1):
+		return -1
+	case math.IsInf(f, -1):
+		return 1
+	}
+
+	t := math.Trunc(f)
+	frac := f - t
+
+	var c int
+	if a.kind == intNumber {
+		switch {
+		case t >= math.Exp2(63):
+			return -1
+		case t < -math.Exp2(63):
+			return 1
+		}
+		c = cmp.Compare(a.i, int64(t))
+	} else {
+		switch {
+		case t < 0:
+			return 1
+		case t >= math.Exp2(64):
+			return -1
+		}
+		c = cmp.Compare(a.u, uint64(t))
+	}
+
+	if c != 0 {
+		return c
+	}
+	return cmp.Compare(0, frac)
+}
@@ -0,0 +1,396 @@
+package conditions
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/raphaelreyna/policyauthor"
+	"github.com/raphaelreyna/policyauthor/pkg/maputils"
+)
+
+// OptimizeStats counts the rewrites made by Optimize.
+type OptimizeStats struct {
+	// Flattened counts the and and or conditions merged into their parent, or replaced by their only child.
+	Flattened int `json:"flattened"`
+	// Deduplicated counts the conditions removed because an identical sibling precedes them.
+	Deduplicated int `json:"deduplicated"`
+	// NegationsFolded counts the pairs of nested not conditions removed.
+	NegationsFolded int `json:"negationsFolded"`
+	// SetLookups counts the runs of equal conditions on a key replaced by a single set lookup.
+	SetLookups int `json:"setLookups"`
+	// Reordered counts the lists of siblings reordered by estimated cost.
+	Reordered int `json:"reordered"`
+}
+
+// Optimize rewrites the conditions of the policies of pe into equivalent ones that are cheaper to evaluate.
+// It must not be called concurrently with Evaluate, and is best called before enabling coverage,
+// as the outcomes of the conditions it replaces are no longer recorded.
+//
+// Optimize merges and conditions nested in and conditions, and or conditions nested in or conditions,
+// removes conditions an identical sibling precedes, replaces not (not (c)) with c,
+// and replaces runs of equal conditions on the same key in an or condition with a single set lookup.
+//
+// Siblings are reordered, cheapest first, only when they fail on exactly the same evaluation contexts,
+// as evaluating a sibling that fails earlier or later than another would change which contexts fail.
+// For instance string, substring, glob and regex conditions on the same key all fail when the key is missing
+// or does not hold a string, and are reordered, while an exists condition is never moved ahead of a regex condition
+// since it would turn the failure of the regex condition on a missing key into a miss.
+// Errors are reported for the same contexts, though their messages may differ.
+//
+// The outcomes and values of evaluations are preserved: conditions returning values are never moved, removed or merged,
+// and neither are the siblings of conditions returning values in and conditions.
+// Conditions whose outcome depends on more than the evaluation context, such as rate limits, are never removed.
+// The learned order of adaptive and and or conditions is reset.
+func Optimize(pe *policyauthor.PolicyEngine) OptimizeStats {
+	var o optimizer
+	for _, p := range pe.Policies() {
+		for i, c := range p.Conditions {
+			p.Conditions[i] = o.condition(c, !valueReturnEnabled(c))
+		}
+		// A policy hits on the first of its conditions that matches, like an or condition.
+		p.Conditions = o.siblings(p.Conditions, true)
+	}
+	return o.stats
+}
+
+type optimizer struct {
+	stats OptimizeStats
+}
+
+// condition optimizes c and returns it, or the condition replacing it.
+// c may only be replaced by a condition of another type when replaceable is set,
+// that is when its parent evaluates it with Evaluate and handles all types alike.
+func (o *optimizer) condition(c *policyauthor.Condition, replaceable bool) *policyauthor.Condition {
+	switch s := c.Spec.(type) {
+	case *AndSpec:
+		// And conditions returning values return no value when a child that is not a ValueReturner misses,
+		// and an empty one when a ValueReturner not returning values misses, so their children are left as they are.
+		enabled := s.ValueReturnEnabled()
+		for i, child := range s.Conditions {
+			s.Conditions[i] = o.condition(child, !enabled)
+		}
+		if !enabled {
+			s.Conditions = o.siblings(s.Conditions, false)
+			s.ResetOrder()
+		}
+		if replaceable && len(s.Conditions) == 1 {
+			o.stats.Flattened++
+			return s.Conditions[0]
+		}
+	case *OrSpec:
+		for i, child := range s.Conditions {
+			s.Conditions[i] = o.condition(child, !valueReturnEnabled(child))
+		}
+		s.Conditions = o.siblings(s.Conditions, true)
+		s.ResetOrder()
+		if replaceable && len(s.Conditions) == 1 {
+			o.stats.Flattened++
+			return s.Conditions[0]
+		}
+	case *NotSpec:
+		inner := o.condition(&s.Condition, !valueReturnEnabled(&s.Condition))
+		s.Condition = *inner
+		if n, ok := inner.Spec.(*NotSpec); ok && replaceable {
+			o.stats.NegationsFolded++
+			return &n.Condition
+		}
+	case policyauthor.ConditionParent:
+		for _, child := range s.Children() {
+			o.condition(child, false)
+		}
+	}
+	return c
+}
+
+// siblings optimizes the list of children of an and condition, or of an or condition when or is set.
+// The children have already been optimized.
+func (o *optimizer) siblings(conditions []*policyauthor.Condition, or bool) []*policyauthor.Condition {
+	conditions = o.flatten(conditions, or)
+	conditions = o.dedupe(conditions)
+	if or {
+		conditions = o.setLookups(conditions)
+	}
+	return o.reorder(conditions)
+}
+
+// flatten merges the children of the and children of an and condition, or of the or children of an or condition,
+// unless they are adaptive or return values.
+func (o *optimizer) flatten(conditions []*policyauthor.Condition, or bool) []*policyauthor.Condition {
+	var out []*policyauthor.Condition
+	for _, c := range conditions {
+		var children []*policyauthor.Condition
+		switch s := c.Spec.(type) {
+		case *AndSpec:
+			if !or && !s.Adaptive {
+				children = s.Conditions
+			}
+		case *OrSpec:
+			if or && !s.Adaptive && !s.ValueReturnEnabled() {
+				children = s.Conditions
+			}
+		}
+		if children == nil {
+			out = append(out, c)
+			continue
+		}
+		o.stats.Flattened++
+		out = append(out, children...)
+	}
+	return out
+}
+
+// dedupe removes the conditions preceded by an identical sibling.
+// When the sibling did not already decide the evaluation, the condition would evaluate to the same outcome.
+func (o *optimizer) dedupe(conditions []*policyauthor.Condition) []*policyauthor.Condition {
+	out := conditions[:0]
+	for _, c := range conditions {
+		removable := !valueReturnEnabled(c) && !volatile(c)
+		if removable && slices.ContainsFunc(out, func(prev *policyauthor.Condition) bool { return sameCondition(prev, c) }) {
+			o.stats.Deduplicated++
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// setLookups replaces the runs of two or more equal conditions on the same key among the children of an or condition
+// with a single set lookup.
+func (o *optimizer) setLookups(conditions []*policyauthor.Condition) []*policyauthor.Condition {
+	var out []*policyauthor.Condition
+	for i := 0; i < len(conditions); {
+		first, ok := equalSetOf(conditions[i])
+		if !ok {
+			out = append(out, conditions[i])
+			i++
+			continue
+		}
+
+		set := newEqualSetSpec(first.Key, first.CaseInsensitive)
+		j := i
+		for ; j < len(conditions); j++ {
+			s, ok := equalSetOf(conditions[j])
+			if !ok || s.Key != set.Key || s.CaseInsensitive != set.CaseInsensitive {
+				break
+			}
+			for _, v := range s.Values {
+				set.add(v)
+			}
+		}
+
+		if j-i < 2 {
+			out = append(out, conditions[i])
+			i++
+			continue
+		}
+
+		o.stats.SetLookups++
+		c := *conditions[i]
+		c.Type = "equal"
+		c.Spec = set
+		out = append(out, &c)
+		i = j
+	}
+	return out
+}
+
+// equalSetOf returns c as a set lookup if it is one, or an equal condition that can be turned into one.
+func equalSetOf(c *policyauthor.Condition) (*equalSetSpec, bool) {
+	switch s := c.Spec.(type) {
+	case *equalSetSpec:
+		return s, true
+	case *EqualSpec:
+		if !s.isScalar || s.Coerce {
+			return nil, false
+		}
+		set := newEqualSetSpec(s.Key, s.CaseInsensitive)
+		set.add(s.Value)
+		return set, true
+	}
+	return nil, false
+}
+
+// reorder sorts the runs of consecutive siblings failing on the same evaluation contexts by estimated cost.
+func (o *optimizer) reorder(conditions []*policyauthor.Condition) []*policyauthor.Condition {
+	reordered := false
+	for i := 0; i < len(conditions); {
+		d, ok := failureDomainOf(conditions[i])
+		j := i + 1
+		for ok && j < len(conditions) {
+			if dj, ok := failureDomainOf(conditions[j]); !ok || dj != d {
+				break
+			}
+			j++
+		}
+
+		run := conditions[i:j]
+		if !slices.IsSortedFunc(run, compareCost) {
+			slices.SortStableFunc(run, compareCost)
+			reordered = true
+		}
+		i = j
+	}
+	if reordered {
+		o.stats.Reordered++
+	}
+	return conditions
+}
+
+// failureDomain describes the evaluation contexts a condition fails on:
+// those missing any of keys, and unless kind is empty, those holding a value that is not of that kind at one of them.
+type failureDomain struct {
+	keys string
+	kind string
+}
+
+// failureDomainOf returns the failure domain of c, and false if c fails on other contexts
+// or may not be moved relative to its siblings.
+func failureDomainOf(c *policyauthor.Condition) (failureDomain, bool) {
+	if valueReturnEnabled(c) || volatile(c) {
+		return failureDomain{}, false
+	}
+
+	switch s := c.Spec.(type) {
+	case *ExistsSpec:
+		return failureDomain{}, true
+	case *EqualSpec:
+		return failureDomain{keys: s.Key}, true
+	case *equalSetSpec:
+		return failureDomain{keys: s.Key}, true
+	case *InSpec:
+		return failureDomain{keys: s.Key, kind: "scalar"}, true
+	case *NotInSpec:
+		return failureDomain{keys: s.Key, kind: "scalar"}, true
+	case *StringSpec:
+		return failureDomain{keys: s.Key, kind: "string"}, true
+	case *SubstringSpec:
+		return failureDomain{keys: s.Key, kind: "string"}, true
+	case *GlobSpec:
+		return failureDomain{keys: s.Key, kind: "string"}, true
+	case *RegexSpec:
+		return failureDomain{keys: s.Key, kind: "string"}, true
+	case *NotSpec:
+		return failureDomainOf(&s.Condition)
+	case *AndSpec:
+		// Children failing on the same contexts only fail when the first does.
+		return commonFailureDomain(s.Conditions)
+	case *OrSpec:
+		return commonFailureDomain(s.Conditions)
+	}
+	return failureDomain{}, false
+}
+
+func commonFailureDomain(conditions []*policyauthor.Condition) (failureDomain, bool) {
+	if len(conditions) == 0 {
+		return failureDomain{}, false
+	}
+	d, ok := failureDomainOf(conditions[0])
+	for _, c := range conditions[1:] {
+		if dc, okc := failureDomainOf(c); !ok || !okc || dc != d {
+			return failureDomain{}, false
+		}
+	}
+	return d, ok
+}
+
+func compareCost(a, b *policyauthor.Condition) int {
+	return cost(a) - cost(b)
+}
+
+// cost estimates the relative cost of evaluating c.
+func cost(c *policyauthor.Condition) int {
+	switch s := c.Spec.(type) {
+	case *ExistsSpec, *EqualSpec, *equalSetSpec, *InSpec, *NotInSpec:
+		return 1
+	case *StringSpec, *SubstringSpec:
+		return 2
+	case *GlobSpec:
+		return 3
+	case *RegexSpec:
+		return 4
+	case *NotSpec:
+		return cost(&s.Condition)
+	case policyauthor.ConditionParent:
+		n := 0
+		for _, child := range s.Children() {
+			n += cost(child)
+		}
+		return n
+	}
+	return 5
+}
+
+func valueReturnEnabled(c *policyauthor.Condition) bool {
+	vr, ok := c.Spec.(policyauthor.ValueReturner)
+	return ok && vr.ValueReturnEnabled()
+}
+
+// sameCondition reports whether a and b are identical definitions.
+func sameCondition(a, b *policyauthor.Condition) bool {
+	switch as := a.Spec.(type) {
+	case *AndSpec:
+		bs, ok := b.Spec.(*AndSpec)
+		return ok && slices.EqualFunc(as.Conditions, bs.Conditions, sameCondition)
+	case *OrSpec:
+		bs, ok := b.Spec.(*OrSpec)
+		return ok && slices.EqualFunc(as.Conditions, bs.Conditions, sameCondition)
+	case *NotSpec:
+		bs, ok := b.Spec.(*NotSpec)
+		return ok && sameCondition(&as.Condition, &bs.Condition)
+	case policyauthor.ConditionParent:
+		return false
+	}
+	return sameSpec(a.Spec, b.Spec)
+}
+
+// equalSetSpec matches when the value at Key equals one of Values, as would an or of equal conditions on Key.
+// Unlike InSpec, it does not fail when the value at Key is not a scalar.
+type equalSetSpec struct {
+	Key             string
+	Values          []any
+	CaseInsensitive bool
+
+	set map[any]struct{}
+}
+
+func newEqualSetSpec(key string, caseInsensitive bool) *equalSetSpec {
+	return &equalSetSpec{Key: key, CaseInsensitive: caseInsensitive, set: map[any]struct{}{}}
+}
+
+// add adds the scalar v to the set unless it already holds it.
+func (s *equalSetSpec) add(v any) {
+	k, _ := scalarKey(v, s.CaseInsensitive)
+	if _, ok := s.set[k]; ok {
+		return
+	}
+	s.set[k] = struct{}{}
+	s.Values = append(s.Values, v)
+}
+
+func (s *equalSetSpec) String() string {
+	values := make([]string, len(s.Values))
+	for i, v := range s.Values {
+		values[i] = fmt.Sprintf("%+v", v)
+	}
+	return fmt.Sprintf("[%s] EQUALS ONE OF [%s]", s.Key, strings.Join(values, ", "))
+}
+
+func (s *equalSetSpec) ContextKeys() []string {
+	return []string{s.Key}
+}
+
+func (s *equalSetSpec) Evaluate(v map[string]any) (bool, error) {
+	val, found := maputils.RecursiveGet(s.Key, v)
+	if !found {
+		return false, policyauthor.NewKeyNotFoundError(s.Key)
+	}
+
+	k, err := scalarKey(val, s.CaseInsensitive)
+	if err != nil {
+		return false, nil
+	}
+
+	_, ok := s.set[k]
+	return ok, nil
+}
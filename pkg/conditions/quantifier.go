@@ -0,0 +1,257 @@
+package conditions
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+
+	"github.com/raphaelreyna/policyauthor"
+	"github.com/raphaelreyna/policyauthor/pkg/maputils"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultElementKey is the key each list element is bound to when evaluating the nested condition of a quantifier.
+const defaultElementKey = "$"
+
+// AnySpec matches when Condition matches at least one element of the list at Key.
+//
+// Condition is evaluated once per element, against the evaluation context with the element bound to As
+// ("$" by default), so that "$" refers to the element itself and "$.name" to a field of a map element.
+type AnySpec struct {
+	Key       string                 `yaml:"key"`
+	As        string                 `yaml:"as"`
+	Condition policyauthor.Condition `yaml:"condition"`
+}
+
+func (s *AnySpec) String() string {
+	return fmt.Sprintf("ANY [%s] (%s)", s.Key, &s.Condition)
+}
+
+func (s *AnySpec) ContextKeys() []string {
+	return []string{s.Key}
+}
+
+func (s *AnySpec) Children() []*policyauthor.Condition {
+	return []*policyauthor.Condition{&s.Condition}
+}
+
+func (s *AnySpec) UnmarshalYAML(value *yaml.Node) error {
+	type T AnySpec
+	var t T
+	if err := value.Decode(&t); err != nil {
+		return err
+	}
+	*s = AnySpec(t)
+
+	if s.Condition.Spec == nil {
+		return fmt.Errorf("AnySpec error: condition must be set")
+	}
+
+	return nil
+}
+
+func (s *AnySpec) Evaluate(v map[string]any) (bool, error) {
+	found := false
+	err := forEachElement(s.Key, s.As, &s.Condition, v, func(hit bool) bool {
+		found = hit
+		return hit
+	})
+	return found, err
+}
+
+// AllSpec matches when Condition matches every element of the list at Key, including when the list is empty.
+type AllSpec struct {
+	Key       string                 `yaml:"key"`
+	As        string                 `yaml:"as"`
+	Condition policyauthor.Condition `yaml:"condition"`
+}
+
+func (s *AllSpec) String() string {
+	return fmt.Sprintf("ALL [%s] (%s)", s.Key, &s.Condition)
+}
+
+func (s *AllSpec) ContextKeys() []string {
+	return []string{s.Key}
+}
+
+func (s *AllSpec) Children() []*policyauthor.Condition {
+	return []*policyauthor.Condition{&s.Condition}
+}
+
+func (s *AllSpec) UnmarshalYAML(value *yaml.Node) error {
+	type T AllSpec
+	var t T
+	if err := value.Decode(&t); err != nil {
+		return err
+	}
+	*s = AllSpec(t)
+
+	if s.Condition.Spec == nil {
+		return fmt.Errorf("AllSpec error: condition must be set")
+	}
+
+	return nil
+}
+
+func (s *AllSpec) Evaluate(v map[string]any) (bool, error) {
+	all := true
+	err := forEachElement(s.Key, s.As, &s.Condition, v, func(hit bool) bool {
+		all = hit
+		return !hit
+	})
+	if err != nil {
+		return false, err
+	}
+	return all, nil
+}
+
+// NoneSpec matches when Condition matches no element of the list at Key.
+type NoneSpec struct {
+	Key       string                 `yaml:"key"`
+	As        string                 `yaml:"as"`
+	Condition policyauthor.Condition `yaml:"condition"`
+}
+
+func (s *NoneSpec) String() string {
+	return fmt.Sprintf("NONE [%s] (%s)", s.Key, &s.Condition)
+}
+
+func (s *NoneSpec) ContextKeys() []string {
+	return []string{s.Key}
+}
+
+func (s *NoneSpec) Children() []*policyauthor.Condition {
+	return []*policyauthor.Condition{&s.Condition}
+}
+
+func (s *NoneSpec) UnmarshalYAML(value *yaml.Node) error {
+	type T NoneSpec
+	var t T
+	if err := value.Decode(&t); err != nil {
+		return err
+	}
+	*s = NoneSpec(t)
+
+	if s.Condition.Spec == nil {
+		return fmt.Errorf("NoneSpec error: condition must be set")
+	}
+
+	return nil
+}
+
+func (s *NoneSpec) Evaluate(v map[string]any) (bool, error) {
+	none := true
+	err := forEachElement(s.Key, s.As, &s.Condition, v, func(hit bool) bool {
+		none = !hit
+		return hit
+	})
+	if err != nil {
+		return false, err
+	}
+	return none, nil
+}
+
+// CountSpec matches when the number of elements of the list at Key matching Condition is within Min and Max, inclusive.
+type CountSpec struct {
+	Key       string                 `yaml:"key"`
+	As        string                 `yaml:"as"`
+	Min       *int                   `yaml:"min"`
+	Max       *int                   `yaml:"max"`
+	Condition policyauthor.Condition `yaml:"condition"`
+}
+
+func (s *CountSpec) String() string {
+	return fmt.Sprintf("COUNT [%s] (%s) BETWEEN %s AND %s", s.Key, &s.Condition, fmtBound(s.Min), fmtBound(s.Max))
+}
+
+func (s *CountSpec) ContextKeys() []string {
+	return []string{s.Key}
+}
+
+func (s *CountSpec) Children() []*policyauthor.Condition {
+	return []*policyauthor.Condition{&s.Condition}
+}
+
+func (s *CountSpec) UnmarshalYAML(value *yaml.Node) error {
+	type T CountSpec
+	var t T
+	if err := value.Decode(&t); err != nil {
+		return err
+	}
+	*s = CountSpec(t)
+
+	if s.Condition.Spec == nil {
+		return fmt.Errorf("CountSpec error: condition must be set")
+	}
+	if s.Min == nil && s.Max == nil {
+		return fmt.Errorf("CountSpec error: at least one of min or max must be set")
+	}
+
+	return nil
+}
+
+func (s *CountSpec) Evaluate(v map[string]any) (bool, error) {
+	count := 0
+	err := forEachElement(s.Key, s.As, &s.Condition, v, func(hit bool) bool {
+		if hit {
+			count++
+		}
+		// Once above the maximum, further matches cannot change the outcome.
+		return s.Max != nil && count > *s.Max
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if s.Min != nil && count < *s.Min {
+		return false, nil
+	}
+	if s.Max != nil && count > *s.Max {
+		return false, nil
+	}
+	return true, nil
+}
+
+func fmtBound(b *int) string {
+	if b == nil {
+		return "*"
+	}
+	return fmt.Sprint(*b)
+}
+
+// forEachElement evaluates c against each element of the list at key, bound to as in a copy of v.
+// fn is called with the result for each element and stops the iteration by returning true.
+func forEachElement(key, as string, c *policyauthor.Condition, v map[string]any, fn func(hit bool) (stop bool)) error {
+	if c.Spec == nil {
+		return fmt.Errorf("condition must be set for quantifier over key %s", key)
+	}
+
+	val, found := maputils.RecursiveGet(key, v)
+	if !found {
+		return policyauthor.NewKeyNotFoundError(key)
+	}
+
+	if as == "" {
+		as = defaultElementKey
+	}
+
+	rv := reflect.ValueOf(val)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return fmt.Errorf("value at key %s is not a list, got %T", key, val)
+	}
+
+	ctx := maps.Clone(v)
+	for i := 0; i < rv.Len(); i++ {
+		ctx[as] = rv.Index(i).Interface()
+
+		hit, err := c.Evaluate(ctx)
+		if err != nil {
+			return err
+		}
+		if fn(hit) {
+			return nil
+		}
+	}
+
+	return nil
+}
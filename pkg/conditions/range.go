@@ -2,20 +2,47 @@ package conditions
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/raphaelreyna/policyauthor"
 	"github.com/raphaelreyna/policyauthor/pkg/maputils"
 	"gopkg.in/yaml.v3"
 )
 
+// RangeSpec matches when the number at Key is within the configured bounds.
+// Lower and Upper are inclusive, GreaterThan and LessThan are exclusive.
+//
+// Any Go numeric type and json.Number are accepted.
+// Numeric strings are only accepted when NumericStrings is set.
+// Bounds are built from Go values with NewNumber.
 type RangeSpec struct {
-	Key   string   `yaml:"key"`
-	Lower *float64 `yaml:"lower,omitempty"`
-	Upper *float64 `yaml:"upper,omitempty"`
+	Key            string  `yaml:"key"`
+	Lower          *Number `yaml:"lower,omitempty"`
+	Upper          *Number `yaml:"upper,omitempty"`
+	GreaterThan    *Number `yaml:"gt,omitempty"`
+	LessThan       *Number `yaml:"lt,omitempty"`
+	NumericStrings bool    `yaml:"numericStrings"`
 }
 
 func (s *RangeSpec) String() string {
-	return fmt.Sprintf("[%s] BETWEEN %d AND %d", s.Key, s.Lower, s.Upper)
+	var bounds []string
+	if s.Lower != nil {
+		bounds = append(bounds, fmt.Sprintf(">= %s", s.Lower))
+	}
+	if s.GreaterThan != nil {
+		bounds = append(bounds, fmt.Sprintf("> %s", s.GreaterThan))
+	}
+	if s.Upper != nil {
+		bounds = append(bounds, fmt.Sprintf("<= %s", s.Upper))
+	}
+	if s.LessThan != nil {
+		bounds = append(bounds, fmt.Sprintf("< %s", s.LessThan))
+	}
+	return fmt.Sprintf("[%s] %s", s.Key, strings.Join(bounds, " AND "))
+}
+
+func (s *RangeSpec) ContextKeys() []string {
+	return []string{s.Key}
 }
 
 func (s *RangeSpec) UnmarshalYAML(value *yaml.Node) error {
@@ -26,8 +53,14 @@ func (s *RangeSpec) UnmarshalYAML(value *yaml.Node) error {
 	}
 	*s = RangeSpec(ss)
 
-	if s.Lower == nil && s.Upper == nil {
-		return fmt.Errorf("RangeSpec error: both lower and upper bounds are nil")
+	if s.Lower == nil && s.Upper == nil && s.GreaterThan == nil && s.LessThan == nil {
+		return fmt.Errorf("RangeSpec error: no bounds set")
+	}
+	if s.Lower != nil && s.GreaterThan != nil {
+		return fmt.Errorf("RangeSpec error: cannot have both lower and gt")
+	}
+	if s.Upper != nil && s.LessThan != nil {
+		return fmt.Errorf("RangeSpec error: cannot have both upper and lt")
 	}
 
 	return nil
@@ -39,41 +72,21 @@ func (s *RangeSpec) Evaluate(v map[string]interface{}) (bool, error) {
 		return false, policyauthor.NewKeyNotFoundError(s.Key)
 	}
 
+	x, ok := toNumber(val, s.NumericStrings)
+	if !ok {
+		return false, fmt.Errorf("RangeSpec error: value at key %s is not a number, got %T", s.Key, val)
+	}
+
 	switch {
-	case s.Lower != nil && s.Upper != nil:
-		switch v := val.(type) {
-		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
-			x := float64(v.(int))
-			return x >= *s.Lower && x <= *s.Upper, nil
-		case float32, float64:
-			x := v.(float64)
-			return x >= *s.Lower && x <= *s.Upper, nil
-		default:
-			return false, fmt.Errorf("key %s is not a number", s.Key)
-		}
-	case s.Lower != nil:
-		switch v := val.(type) {
-		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
-			x := float64(v.(int))
-			return x >= *s.Lower, nil
-		case float32, float64:
-			x := v.(float64)
-			return x >= *s.Lower, nil
-		default:
-			return false, fmt.Errorf("key %s is not a number", s.Key)
-		}
-	case s.Upper != nil:
-		switch v := val.(type) {
-		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
-			x := float64(v.(int))
-			return x <= *s.Upper, nil
-		case float32, float64:
-			x := v.(float64)
-			return x <= *s.Upper, nil
-		default:
-			return false, fmt.Errorf("key %s is not a number", s.Key)
-		}
-	default:
-		return false, fmt.Errorf("RangeSpec error: both lower and upper bounds are nil")
+	case s.Lower != nil && compareNumbers(x, *s.Lower) < 0:
+		return false, nil
+	case s.GreaterThan != nil && compareNumbers(x, *s.GreaterThan) <= 0:
+		return false, nil
+	case s.Upper != nil && compareNumbers(x, *s.Upper) > 0:
+		return false, nil
+	case s.LessThan != nil && compareNumbers(x, *s.LessThan) >= 0:
+		return false, nil
 	}
+
+	return true, nil
 }
@@ -0,0 +1,190 @@
+package conditions
+
+import (
+	"container/list"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/raphaelreyna/policyauthor"
+	"github.com/raphaelreyna/policyauthor/pkg/hashutils"
+	"github.com/raphaelreyna/policyauthor/pkg/maputils"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultRateLimitMaxKeys = 10000
+
+// RateLimitSpec matches when the rate of evaluations sharing the same values at Keys exceeds Limit per Window.
+//
+// Each evaluation reaching the condition takes a token from a bucket holding up to Limit tokens,
+// refilled at Limit tokens per Window. The condition matches when the bucket is empty.
+// At most MaxKeys buckets are tracked, the least recently used bucket is evicted first.
+//
+// Buckets are held by the engine and shared by its conditions with the same definition.
+// PolicyEngine.InheritState hands them over to a reloaded engine.
+// Name can be used to keep otherwise identical conditions apart.
+type RateLimitSpec struct {
+	Name    string   `yaml:"name"`
+	Key     string   `yaml:"key"`
+	Keys    []string `yaml:"keys"`
+	Limit   int      `yaml:"limit"`
+	Window  string   `yaml:"window"`
+	MaxKeys int      `yaml:"maxKeys"`
+
+	window  time.Duration      `yaml:"-"`
+	limiter *rateLimiter       `yaml:"-"`
+	clock   policyauthor.Clock `yaml:"-"`
+}
+
+func (s *RateLimitSpec) UnmarshalYAML(value *yaml.Node) error {
+	type T RateLimitSpec
+	var t T
+	if err := value.Decode(&t); err != nil {
+		return err
+	}
+	*s = RateLimitSpec(t)
+
+	if s.Key != "" {
+		s.Keys = append([]string{s.Key}, s.Keys...)
+	}
+	if len(s.Keys) == 0 {
+		return fmt.Errorf("RateLimitSpec error: at least one key must be set")
+	}
+	if s.Limit <= 0 {
+		return fmt.Errorf("RateLimitSpec error: limit must be positive")
+	}
+	if s.MaxKeys == 0 {
+		s.MaxKeys = defaultRateLimitMaxKeys
+	}
+	if s.MaxKeys < 0 {
+		return fmt.Errorf("RateLimitSpec error: maxKeys must be positive")
+	}
+
+	window, err := parseDuration(s.Window)
+	if err != nil {
+		return fmt.Errorf("RateLimitSpec error: invalid window: %s", err)
+	}
+	if window <= 0 {
+		return fmt.Errorf("RateLimitSpec error: window must be positive")
+	}
+	s.window = window
+	s.limiter = s.NewState().(*rateLimiter)
+
+	return nil
+}
+
+func (s *RateLimitSpec) StateKey() string {
+	return fmt.Sprintf("%q %q %d %s %d", s.Name, s.Keys, s.Limit, s.window, s.MaxKeys)
+}
+
+func (s *RateLimitSpec) NewState() any {
+	return &rateLimiter{
+		capacity: float64(s.Limit),
+		rate:     float64(s.Limit) / float64(s.window),
+		maxKeys:  s.MaxKeys,
+		buckets:  map[string]*list.Element{},
+		lru:      list.New(),
+	}
+}
+
+func (s *RateLimitSpec) SetState(state any) {
+	s.limiter = state.(*rateLimiter)
+}
+
+func (s *RateLimitSpec) SetClock(c policyauthor.Clock) {
+	s.clock = c
+}
+
+func (s *RateLimitSpec) String() string {
+	return fmt.Sprintf("[%s] EXCEEDS %d PER %s", strings.Join(s.Keys, ", "), s.Limit, s.Window)
+}
+
+func (s *RateLimitSpec) ContextKeys() []string {
+	return s.Keys
+}
+
+// Volatile always reports true, the outcome depends on previous evaluations.
+func (s *RateLimitSpec) Volatile() bool {
+	return true
+}
+
+func (s *RateLimitSpec) Evaluate(v map[string]any) (bool, error) {
+	if s.limiter == nil {
+		return false, fmt.Errorf("RateLimitSpec error: condition was not unmarshaled")
+	}
+
+	var b strings.Builder
+	for i, key := range s.Keys {
+		val, found := maputils.RecursiveGet(key, v)
+		if !found {
+			return false, policyauthor.NewKeyNotFoundError(key)
+		}
+
+		str, err := hashutils.Canonical(val)
+		if err != nil {
+			return false, fmt.Errorf("RateLimitSpec error: value at key %s: %s", key, err)
+		}
+		if i > 0 {
+			b.WriteByte(0)
+		}
+		b.WriteString(str)
+	}
+
+	now := policyauthor.SystemClock.Now()
+	if s.clock != nil {
+		now = s.clock.Now()
+	}
+
+	return !s.limiter.take(b.String(), now), nil
+}
+
+// rateLimiter is a set of token buckets with least recently used eviction.
+type rateLimiter struct {
+	capacity float64
+	// rate is the number of tokens added per nanosecond.
+	rate    float64
+	maxKeys int
+
+	mu      sync.Mutex
+	buckets map[string]*list.Element
+	lru     *list.List
+}
+
+type tokenBucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// take removes a token from the bucket for key, reporting whether one was available.
+func (l *rateLimiter) take(key string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var b *tokenBucket
+	if e, ok := l.buckets[key]; ok {
+		l.lru.MoveToFront(e)
+		b = e.Value.(*tokenBucket)
+
+		if elapsed := now.Sub(b.last); elapsed > 0 {
+			b.tokens = min(l.capacity, b.tokens+float64(elapsed)*l.rate)
+			b.last = now
+		}
+	} else {
+		if l.lru.Len() >= l.maxKeys {
+			oldest := l.lru.Back()
+			l.lru.Remove(oldest)
+			delete(l.buckets, oldest.Value.(*tokenBucket).key)
+		}
+
+		b = &tokenBucket{key: key, tokens: l.capacity, last: now}
+		l.buckets[key] = l.lru.PushFront(b)
+	}
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
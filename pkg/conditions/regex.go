@@ -3,11 +3,10 @@ package conditions
 import (
 	"fmt"
 	"regexp"
-	"strconv"
-	"strings"
 
 	"github.com/raphaelreyna/policyauthor"
 	"github.com/raphaelreyna/policyauthor/pkg/maputils"
+	"github.com/raphaelreyna/policyauthor/pkg/regexutils"
 	"gopkg.in/yaml.v3"
 )
 
@@ -23,6 +22,10 @@ func (s *RegexSpec) String() string {
 	return fmt.Sprintf("[%s] MATCHES REGEX %+v", s.Key, s.Pattern)
 }
 
+func (s *RegexSpec) ContextKeys() []string {
+	return []string{s.Key}
+}
+
 func (s *RegexSpec) UnmarshalYAML(value *yaml.Node) error {
 	type S RegexSpec
 
@@ -67,48 +70,7 @@ func (s *RegexSpec) EvaluateWithReturnValue(v map[string]interface{}) (interface
 			return nil, false, nil
 		}
 
-		return formatWithRegex(s.r, val, s.Return), true, nil
+		return regexutils.Format(s.r, val, s.Return), true, nil
 	}
 	return nil, false, policyauthor.NewKeyNotFoundError(s.Key)
 }
-
-// formatWithRegex takes a compiled regex, a target string, and a format string.
-// It replaces placeholders like \1, \2, etc., in the format string with the corresponding matched groups.
-func formatWithRegex(regex *regexp.Regexp, target, format string) string {
-	matches := regex.FindStringSubmatch(target)
-	if len(matches) == 0 {
-		return "" // No match found
-	}
-	if matches[0] == "" {
-		return "" // No match found
-	}
-
-	// Split the format string and replace placeholders with the matched groups.
-	result := strings.Builder{}
-	lastPos := 0
-	for i := 0; i < len(format)-1; i++ {
-		if format[i] == '\\' && '1' <= format[i+1] && format[i+1] <= '9' {
-			// Append the part before the placeholder
-			result.WriteString(format[lastPos:i])
-
-			// Convert the character after '\' to an index
-			index, _ := strconv.Atoi(string(format[i+1]))
-
-			// Append the corresponding group if it exists
-			if index < len(matches) {
-				result.WriteString(matches[index])
-			}
-
-			// Skip over the number
-			i++
-			lastPos = i + 1
-		}
-	}
-
-	// Append the remaining part of the format string
-	if lastPos < len(format) {
-		result.WriteString(format[lastPos:])
-	}
-
-	return result.String()
-}
@@ -0,0 +1,104 @@
+package conditions
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/raphaelreyna/policyauthor"
+	"github.com/raphaelreyna/policyauthor/pkg/hashutils"
+	"github.com/raphaelreyna/policyauthor/pkg/maputils"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultRolloutBuckets = 10000
+
+// RolloutSpec assigns each evaluation context to one of Buckets buckets by hashing the values at Keys with Salt,
+// and matches when that bucket is within the first Percentage percent of buckets or within BucketRange.
+//
+// The assignment only depends on the salt and the key values, so the same values always land in the same bucket,
+// across processes and releases. Changing the salt reshuffles every context.
+type RolloutSpec struct {
+	Key         string   `yaml:"key"`
+	Keys        []string `yaml:"keys"`
+	Salt        string   `yaml:"salt"`
+	Percentage  *float64 `yaml:"percentage"`
+	BucketRange []uint64 `yaml:"bucketRange"`
+	Buckets     uint64   `yaml:"buckets"`
+
+	lo, hi uint64 `yaml:"-"`
+}
+
+func (s *RolloutSpec) UnmarshalYAML(value *yaml.Node) error {
+	type T RolloutSpec
+	var t T
+	if err := value.Decode(&t); err != nil {
+		return err
+	}
+	*s = RolloutSpec(t)
+
+	if s.Key != "" {
+		s.Keys = append([]string{s.Key}, s.Keys...)
+	}
+	if len(s.Keys) == 0 {
+		return fmt.Errorf("RolloutSpec error: at least one key must be set")
+	}
+
+	if s.Buckets == 0 {
+		s.Buckets = defaultRolloutBuckets
+	}
+
+	switch {
+	case s.Percentage != nil && s.BucketRange != nil:
+		return fmt.Errorf("RolloutSpec error: cannot have both percentage and bucketRange")
+	case s.Percentage != nil:
+		p := *s.Percentage
+		if p < 0 || p > 100 {
+			return fmt.Errorf("RolloutSpec error: percentage must be between 0 and 100, got %v", p)
+		}
+		s.lo, s.hi = 0, uint64(p/100*float64(s.Buckets)+0.5)
+	case s.BucketRange != nil:
+		if len(s.BucketRange) != 2 || s.BucketRange[0] > s.BucketRange[1] || s.BucketRange[1] >= s.Buckets {
+			return fmt.Errorf("RolloutSpec error: bucketRange must be [from, to] with from <= to < %d", s.Buckets)
+		}
+		s.lo, s.hi = s.BucketRange[0], s.BucketRange[1]+1
+	default:
+		return fmt.Errorf("RolloutSpec error: one of percentage or bucketRange must be set")
+	}
+
+	return nil
+}
+
+func (s *RolloutSpec) String() string {
+	return fmt.Sprintf("[%s] IN BUCKETS [%d, %d) OF %d SALTED %q", strings.Join(s.Keys, ", "), s.lo, s.hi, s.Buckets, s.Salt)
+}
+
+func (s *RolloutSpec) ContextKeys() []string {
+	return s.Keys
+}
+
+func (s *RolloutSpec) Evaluate(v map[string]any) (bool, error) {
+	b, err := rolloutBucket(s.Keys, s.Salt, s.Buckets, v)
+	if err != nil {
+		return false, err
+	}
+	return b >= s.lo && b < s.hi, nil
+}
+
+// rolloutBucket hashes the salt and the values at keys into one of n buckets.
+func rolloutBucket(keys []string, salt string, n uint64, v map[string]any) (uint64, error) {
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		val, found := maputils.RecursiveGet(key, v)
+		if !found {
+			return 0, policyauthor.NewKeyNotFoundError(key)
+		}
+
+		str, err := hashutils.Canonical(val)
+		if err != nil {
+			return 0, fmt.Errorf("value at key %s: %s", key, err)
+		}
+		values[i] = str
+	}
+
+	return hashutils.Hash(salt, values...) % n, nil
+}
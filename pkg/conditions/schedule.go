@@ -0,0 +1,288 @@
+package conditions
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/raphaelreyna/policyauthor"
+	"github.com/raphaelreyna/policyauthor/pkg/maputils"
+	"gopkg.in/yaml.v3"
+)
+
+const dateLayout = "2006-01-02"
+
+// ScheduleSpec matches when a time falls within a recurring schedule.
+// The time is read from Key, or from the engine clock when Key is empty.
+//
+// A time is within the schedule if it falls within any of the Windows or matches any of the Cron expressions,
+// and its date (in Timezone) is not listed in Exclude or in the file at ExcludeFrom.
+type ScheduleSpec struct {
+	Key         string           `yaml:"key"`
+	Layout      string           `yaml:"layout"`
+	Timezone    string           `yaml:"timezone"`
+	Windows     []ScheduleWindow `yaml:"windows"`
+	Cron        []string         `yaml:"cron"`
+	Exclude     []string         `yaml:"exclude"`
+	ExcludeFrom string           `yaml:"excludeFrom"`
+
+	loc      *time.Location      `yaml:"-"`
+	crons    []*cronExpr         `yaml:"-"`
+	excluded map[string]struct{} `yaml:"-"`
+	clock    policyauthor.Clock  `yaml:"-"`
+}
+
+// ScheduleWindow is a daily time of day window on the given days of the week.
+// Windows whose End is before their Start span midnight and belong to the day they start on.
+type ScheduleWindow struct {
+	Days  []string `yaml:"days"`
+	Start string   `yaml:"start"`
+	End   string   `yaml:"end"`
+
+	days       [7]bool       `yaml:"-"`
+	start, end time.Duration `yaml:"-"`
+}
+
+func (s *ScheduleSpec) UnmarshalYAML(value *yaml.Node) error {
+	type T ScheduleSpec
+	var t T
+	err := value.Decode(&t)
+	if err != nil {
+		return err
+	}
+	*s = ScheduleSpec(t)
+
+	if len(s.Windows) == 0 && len(s.Cron) == 0 {
+		return fmt.Errorf("ScheduleSpec error: at least one window or cron expression must be set")
+	}
+
+	s.loc = time.UTC
+	if s.Timezone != "" {
+		if s.loc, err = time.LoadLocation(s.Timezone); err != nil {
+			return fmt.Errorf("ScheduleSpec error: could not load timezone %q: %s", s.Timezone, err)
+		}
+	}
+
+	for i := range s.Windows {
+		if err := s.Windows[i].compile(); err != nil {
+			return fmt.Errorf("ScheduleSpec error: window %d: %s", i, err)
+		}
+	}
+
+	s.crons = make([]*cronExpr, len(s.Cron))
+	for i, expr := range s.Cron {
+		if s.crons[i], err = parseCron(expr); err != nil {
+			return fmt.Errorf("ScheduleSpec error: %s", err)
+		}
+	}
+
+	s.excluded = map[string]struct{}{}
+	for _, d := range s.Exclude {
+		if err := s.addExclusion(d); err != nil {
+			return err
+		}
+	}
+	if s.ExcludeFrom != "" {
+		if err := s.loadExclusions(s.ExcludeFrom); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *ScheduleSpec) addExclusion(d string) error {
+	if _, err := time.Parse(dateLayout, d); err != nil {
+		return fmt.Errorf("ScheduleSpec error: invalid exclusion date %q, expected YYYY-MM-DD", d)
+	}
+	s.excluded[d] = struct{}{}
+	return nil
+}
+
+// loadExclusions reads one date per line, ignoring blank lines and lines starting with '#'.
+func (s *ScheduleSpec) loadExclusions(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("ScheduleSpec error: could not open exclusions file: %s", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := s.addExclusion(line); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("ScheduleSpec error: could not read exclusions file: %s", err)
+	}
+
+	return nil
+}
+
+func (s *ScheduleSpec) SetClock(c policyauthor.Clock) {
+	s.clock = c
+}
+
+func (s *ScheduleSpec) String() string {
+	parts := make([]string, 0, len(s.Windows)+len(s.Cron))
+	for _, w := range s.Windows {
+		parts = append(parts, fmt.Sprintf("%s %s-%s", strings.Join(w.Days, ","), w.Start, w.End))
+	}
+	for _, c := range s.Cron {
+		parts = append(parts, fmt.Sprintf("CRON %q", c))
+	}
+
+	key := s.Key
+	if key == "" {
+		key = "now"
+	}
+	return fmt.Sprintf("[%s] IN SCHEDULE %s", key, strings.Join(parts, " | "))
+}
+
+func (s *ScheduleSpec) ContextKeys() []string {
+	if s.Key == "" {
+		return nil
+	}
+	return []string{s.Key}
+}
+
+// Volatile reports whether the outcome depends on the current time.
+func (s *ScheduleSpec) Volatile() bool {
+	return s.Key == ""
+}
+
+func (s *ScheduleSpec) Evaluate(v map[string]any) (bool, error) {
+	var t time.Time
+	if s.Key == "" {
+		if s.clock == nil {
+			t = policyauthor.SystemClock.Now()
+		} else {
+			t = s.clock.Now()
+		}
+	} else {
+		val, found := maputils.RecursiveGet(s.Key, v)
+		if !found {
+			return false, policyauthor.NewKeyNotFoundError(s.Key)
+		}
+
+		layout := time.RFC3339
+		if s.Layout != "" {
+			layout = s.Layout
+		}
+
+		var err error
+		if t, err = toTime(val, layout, s.loc); err != nil {
+			return false, fmt.Errorf("ScheduleSpec error: value at key %s: %s", s.Key, err)
+		}
+	}
+	t = t.In(s.loc)
+
+	if _, ok := s.excluded[t.Format(dateLayout)]; ok {
+		return false, nil
+	}
+
+	for i := range s.Windows {
+		if s.Windows[i].contains(t) {
+			return true, nil
+		}
+	}
+	for _, c := range s.crons {
+		if c.matches(t) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+func (w *ScheduleWindow) compile() error {
+	if len(w.Days) == 0 {
+		for i := range w.days {
+			w.days[i] = true
+		}
+	}
+	for _, d := range w.Days {
+		// Ranges such as mon-fri are allowed.
+		from, to, isRange := strings.Cut(strings.ToLower(d), "-")
+		lo, ok := weekdayNames[from]
+		if !ok {
+			return fmt.Errorf("unknown day %q", d)
+		}
+		hi := lo
+		if isRange {
+			if hi, ok = weekdayNames[to]; !ok {
+				return fmt.Errorf("unknown day %q", d)
+			}
+		}
+		for i := lo; ; i = (i + 1) % 7 {
+			w.days[i] = true
+			if i == hi {
+				break
+			}
+		}
+	}
+
+	var err error
+	if w.start, err = parseTimeOfDay(w.Start, 0); err != nil {
+		return fmt.Errorf("invalid start: %s", err)
+	}
+	if w.end, err = parseTimeOfDay(w.End, 24*time.Hour); err != nil {
+		return fmt.Errorf("invalid end: %s", err)
+	}
+	if w.start == w.end {
+		return fmt.Errorf("start and end must differ")
+	}
+
+	return nil
+}
+
+// contains reports whether t, already in the schedule's time zone, is within the window.
+// The start is inclusive and the end exclusive.
+func (w *ScheduleWindow) contains(t time.Time) bool {
+	tod := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+	day := t.Weekday()
+
+	if w.start < w.end {
+		return w.days[day] && tod >= w.start && tod < w.end
+	}
+
+	yesterday := (day + 6) % 7
+	return (w.days[day] && tod >= w.start) || (w.days[yesterday] && tod < w.end)
+}
+
+// parseTimeOfDay parses HH:MM or HH:MM:SS, returning def for an empty string.
+func parseTimeOfDay(s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	if s == "24:00" {
+		return 24 * time.Hour, nil
+	}
+
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+				time.Duration(t.Second())*time.Second, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%q is not a time of day (HH:MM)", s)
+}
@@ -0,0 +1,381 @@
+package conditions
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/raphaelreyna/policyauthor"
+	"github.com/raphaelreyna/policyauthor/pkg/maputils"
+	"gopkg.in/yaml.v3"
+)
+
+// SemverSpec matches when the semantic version at Key satisfies Constraint.
+//
+// A constraint is one or more comparator sets separated by "||", and matches if any of the sets does.
+// A comparator set is a list of comparators separated by commas or spaces, all of which must match.
+// Supported comparators are =, !=, >, >=, <, <=, ^ (compatible with) and ~ (approximately, also ~>).
+// Versions in constraints may be partial (1.2) or use x and * wildcards (1.x).
+// Versions may be prefixed with a v and are ordered according to SemVer 2.0, including pre-releases.
+type SemverSpec struct {
+	Key        string `yaml:"key"`
+	Constraint string `yaml:"constraint"`
+
+	sets [][]semverComparator `yaml:"-"`
+}
+
+func (s *SemverSpec) UnmarshalYAML(value *yaml.Node) error {
+	type T SemverSpec
+	var t T
+	if err := value.Decode(&t); err != nil {
+		return err
+	}
+	*s = SemverSpec(t)
+
+	var err error
+	if s.sets, err = parseSemverConstraint(s.Constraint); err != nil {
+		return fmt.Errorf("SemverSpec error: %s", err)
+	}
+
+	return nil
+}
+
+func (s *SemverSpec) String() string {
+	return fmt.Sprintf("[%s] SATISFIES %s", s.Key, s.Constraint)
+}
+
+func (s *SemverSpec) ContextKeys() []string {
+	return []string{s.Key}
+}
+
+func (s *SemverSpec) Evaluate(v map[string]any) (bool, error) {
+	val, found := maputils.RecursiveGet(s.Key, v)
+	if !found {
+		return false, policyauthor.NewKeyNotFoundError(s.Key)
+	}
+
+	str, ok := val.(string)
+	if !ok {
+		return false, fmt.Errorf("SemverSpec error: value at key %s is not a string, got %T", s.Key, val)
+	}
+
+	ver, err := parseSemver(str)
+	if err != nil {
+		return false, fmt.Errorf("SemverSpec error: value at key %s: %s", s.Key, err)
+	}
+
+	for _, set := range s.sets {
+		match := true
+		for _, c := range set {
+			if !c.matches(ver) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+type semver struct {
+	major, minor, patch uint64
+	pre                 []string
+}
+
+var semverIdentRegex = regexp.MustCompile(`^[0-9A-Za-z-]+$`)
+
+// parseSemver parses a full major.minor.patch version with optional pre-release and build metadata.
+func parseSemver(s string) (semver, error) {
+	orig := s
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "v"), "V")
+
+	s, _, _ = strings.Cut(s, "+")
+	s, pre, hasPre := strings.Cut(s, "-")
+
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return semver{}, fmt.Errorf("invalid version %q: expected major.minor.patch", orig)
+	}
+
+	var (
+		v   semver
+		err error
+	)
+	for i, dst := range []*uint64{&v.major, &v.minor, &v.patch} {
+		if *dst, err = parseSemverNumber(parts[i]); err != nil {
+			return semver{}, fmt.Errorf("invalid version %q: %s", orig, err)
+		}
+	}
+
+	if hasPre {
+		if v.pre, err = parseSemverPrerelease(pre); err != nil {
+			return semver{}, fmt.Errorf("invalid version %q: %s", orig, err)
+		}
+	}
+
+	return v, nil
+}
+
+func parseSemverNumber(s string) (uint64, error) {
+	if s == "" || (len(s) > 1 && s[0] == '0') {
+		return 0, fmt.Errorf("invalid numeric component %q", s)
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid numeric component %q", s)
+	}
+	return n, nil
+}
+
+func parseSemverPrerelease(s string) ([]string, error) {
+	ids := strings.Split(s, ".")
+	for _, id := range ids {
+		if !semverIdentRegex.MatchString(id) {
+			return nil, fmt.Errorf("invalid pre-release identifier %q", id)
+		}
+		if isNumeric(id) && len(id) > 1 && id[0] == '0' {
+			return nil, fmt.Errorf("pre-release identifier %q has a leading zero", id)
+		}
+	}
+	return ids, nil
+}
+
+func isNumeric(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// compareSemver compares versions by SemVer 2.0 precedence.
+func compareSemver(a, b semver) int {
+	if c := cmp.Compare(a.major, b.major); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(a.minor, b.minor); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(a.patch, b.patch); c != 0 {
+		return c
+	}
+
+	// A version without a pre-release has higher precedence than one with.
+	switch {
+	case len(a.pre) == 0 && len(b.pre) == 0:
+		return 0
+	case len(a.pre) == 0:
+		return 1
+	case len(b.pre) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(a.pre) && i < len(b.pre); i++ {
+		x, y := a.pre[i], b.pre[i]
+		xNum, yNum := isNumeric(x), isNumeric(y)
+		switch {
+		case xNum && yNum:
+			xi, _ := strconv.ParseUint(x, 10, 64)
+			yi, _ := strconv.ParseUint(y, 10, 64)
+			if c := cmp.Compare(xi, yi); c != 0 {
+				return c
+			}
+		case xNum:
+			return -1
+		case yNum:
+			return 1
+		default:
+			if c := strings.Compare(x, y); c != 0 {
+				return c
+			}
+		}
+	}
+
+	return cmp.Compare(len(a.pre), len(b.pre))
+}
+
+type semverComparator struct {
+	op  string
+	ver semver
+}
+
+func (c semverComparator) matches(v semver) bool {
+	x := compareSemver(v, c.ver)
+	switch c.op {
+	case "=":
+		return x == 0
+	case "!=":
+		return x != 0
+	case ">":
+		return x > 0
+	case ">=":
+		return x >= 0
+	case "<":
+		return x < 0
+	default:
+		return x <= 0
+	}
+}
+
+var semverComparatorRegex = regexp.MustCompile(`^\s*(<=|>=|!=|==|=|<|>|\^|~>|~)?\s*([^\s,]+)`)
+
+func parseSemverConstraint(constraint string) ([][]semverComparator, error) {
+	if strings.TrimSpace(constraint) == "" {
+		return nil, fmt.Errorf("constraint must be set")
+	}
+
+	var sets [][]semverComparator
+	for _, alt := range strings.Split(constraint, "||") {
+		var (
+			set  []semverComparator
+			rest = alt
+		)
+		for {
+			rest = strings.TrimLeft(rest, " \t,")
+			if rest == "" {
+				break
+			}
+
+			m := semverComparatorRegex.FindStringSubmatch(rest)
+			if m == nil {
+				return nil, fmt.Errorf("invalid constraint %q", constraint)
+			}
+			rest = rest[len(m[0]):]
+
+			cs, err := expandSemverComparator(m[1], m[2])
+			if err != nil {
+				return nil, fmt.Errorf("invalid constraint %q: %s", constraint, err)
+			}
+			set = append(set, cs...)
+		}
+		if len(set) == 0 {
+			return nil, fmt.Errorf("invalid constraint %q: empty comparator set", constraint)
+		}
+		sets = append(sets, set)
+	}
+
+	return sets, nil
+}
+
+// expandSemverComparator turns a single, possibly partial, comparator into primitive comparators.
+func expandSemverComparator(op, version string) ([]semverComparator, error) {
+	version = strings.TrimPrefix(strings.TrimPrefix(version, "v"), "V")
+	version, _, _ = strings.Cut(version, "+")
+	version, preStr, hasPre := strings.Cut(version, "-")
+
+	parts := strings.Split(version, ".")
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("invalid version %q", version)
+	}
+
+	// n is the number of leading components that are set, the rest are wildcards.
+	var (
+		nums [3]uint64
+		n    int
+	)
+	for i, p := range parts {
+		if p == "x" || p == "X" || p == "*" {
+			break
+		}
+		num, err := parseSemverNumber(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q: %s", version, err)
+		}
+		nums[i] = num
+		n = i + 1
+	}
+
+	var pre []string
+	if hasPre {
+		if n != 3 {
+			return nil, fmt.Errorf("invalid version %q: pre-release requires a full version", version)
+		}
+		var err error
+		if pre, err = parseSemverPrerelease(preStr); err != nil {
+			return nil, fmt.Errorf("invalid version %q: %s", version, err)
+		}
+	}
+
+	lower := semver{major: nums[0], minor: nums[1], patch: nums[2], pre: pre}
+	// bump returns the lowest version above every version matching the first i components.
+	bump := func(i int) semver {
+		v := semver{pre: []string{"0"}}
+		switch i {
+		case 1:
+			v.major = nums[0] + 1
+		case 2:
+			v.major, v.minor = nums[0], nums[1]+1
+		default:
+			v.major, v.minor, v.patch = nums[0], nums[1], nums[2]+1
+		}
+		return v
+	}
+	between := func(lo, hi semver) []semverComparator {
+		return []semverComparator{{op: ">=", ver: lo}, {op: "<", ver: hi}}
+	}
+	anyVersion := []semverComparator{{op: ">=", ver: semver{}}}
+
+	switch op {
+	case "", "=", "==":
+		switch n {
+		case 0:
+			return anyVersion, nil
+		case 3:
+			return []semverComparator{{op: "=", ver: lower}}, nil
+		default:
+			return between(lower, bump(n)), nil
+		}
+	case "!=":
+		if n != 3 {
+			return nil, fmt.Errorf("!= requires a full version")
+		}
+		return []semverComparator{{op: "!=", ver: lower}}, nil
+	case ">":
+		if n == 0 {
+			return nil, fmt.Errorf("> requires a version")
+		}
+		if n == 3 {
+			return []semverComparator{{op: ">", ver: lower}}, nil
+		}
+		return []semverComparator{{op: ">=", ver: bump(n)}}, nil
+	case ">=":
+		return []semverComparator{{op: ">=", ver: lower}}, nil
+	case "<":
+		return []semverComparator{{op: "<", ver: lower}}, nil
+	case "<=":
+		if n == 0 {
+			return anyVersion, nil
+		}
+		if n == 3 {
+			return []semverComparator{{op: "<=", ver: lower}}, nil
+		}
+		return []semverComparator{{op: "<", ver: bump(n)}}, nil
+	case "~", "~>":
+		switch n {
+		case 0:
+			return anyVersion, nil
+		case 1:
+			return between(lower, bump(1)), nil
+		default:
+			return between(lower, bump(2)), nil
+		}
+	default: // "^"
+		switch {
+		case n == 0:
+			return anyVersion, nil
+		case nums[0] != 0 || n == 1:
+			return between(lower, bump(1)), nil
+		case nums[1] != 0 || n == 2:
+			return between(lower, bump(2)), nil
+		default:
+			return between(lower, bump(3)), nil
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package conditions
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/raphaelreyna/policyauthor"
+	"github.com/raphaelreyna/policyauthor/pkg/maputils"
+	"golang.org/x/text/unicode/norm"
+	"gopkg.in/yaml.v3"
+)
+
+// ahoCorasickThreshold is the number of needles above which contains matching uses an Aho-Corasick automaton.
+const ahoCorasickThreshold = 8
+
+// StringSpec matches when the string at Key matches any of the configured values using Op.
+//
+// Op is one of contains (the default), hasPrefix, hasSuffix, equal or equalFold.
+// equalFold is equal with CaseInsensitive set.
+// When Normalize is set to one of nfc, nfd, nfkc or nfkd, both the values and the string at Key
+// are brought into that Unicode normalization form before being compared.
+type StringSpec struct {
+	Key             string   `yaml:"key"`
+	Op              string   `yaml:"op"`
+	Value           string   `yaml:"value"`
+	Values          []string `yaml:"values"`
+	CaseInsensitive bool     `yaml:"caseInsensitive"`
+	Normalize       string   `yaml:"normalize"`
+
+	needles []string     `yaml:"-"`
+	form    *norm.Form   `yaml:"-"`
+	ac      *ahoCorasick `yaml:"-"`
+}
+
+func (s *StringSpec) UnmarshalYAML(value *yaml.Node) error {
+	type T StringSpec
+	var t T
+	if err := value.Decode(&t); err != nil {
+		return err
+	}
+	*s = StringSpec(t)
+
+	switch s.Op {
+	case "":
+		s.Op = "contains"
+	case "equalFold":
+		s.CaseInsensitive = true
+	case "contains", "hasPrefix", "hasSuffix", "equal":
+	default:
+		return fmt.Errorf("StringSpec error: unknown op %q", s.Op)
+	}
+
+	switch strings.ToLower(s.Normalize) {
+	case "":
+	case "nfc":
+		s.form = ptr(norm.NFC)
+	case "nfd":
+		s.form = ptr(norm.NFD)
+	case "nfkc":
+		s.form = ptr(norm.NFKC)
+	case "nfkd":
+		s.form = ptr(norm.NFKD)
+	default:
+		return fmt.Errorf("StringSpec error: unknown normalization form %q", s.Normalize)
+	}
+
+	if s.Value != "" {
+		s.Values = append([]string{s.Value}, s.Values...)
+	}
+	if len(s.Values) == 0 {
+		return fmt.Errorf("StringSpec error: no values set")
+	}
+
+	s.needles = make([]string, len(s.Values))
+	for i, v := range s.Values {
+		s.needles[i] = s.prepare(v)
+	}
+
+	if s.Op == "contains" && len(s.needles) > ahoCorasickThreshold {
+		s.ac = newAhoCorasick(s.needles)
+	}
+
+	return nil
+}
+
+// prepare applies the configured normalization and case folding to x.
+func (s *StringSpec) prepare(x string) string {
+	if s.form != nil {
+		x = s.form.String(x)
+	}
+	if s.CaseInsensitive {
+		x = foldString(x)
+	}
+	return x
+}
+
+func (s *StringSpec) String() string {
+	return fmt.Sprintf("[%s] %s %+v", s.Key, strings.ToUpper(s.Op), s.Values)
+}
+
+func (s *StringSpec) ContextKeys() []string {
+	return []string{s.Key}
+}
+
+func (s *StringSpec) Evaluate(v map[string]any) (bool, error) {
+	val, found := maputils.RecursiveGet(s.Key, v)
+	if !found {
+		return false, policyauthor.NewKeyNotFoundError(s.Key)
+	}
+
+	str, ok := val.(string)
+	if !ok {
+		return false, fmt.Errorf("StringSpec error: value at key %s is not a string, got %T", s.Key, val)
+	}
+	str = s.prepare(str)
+
+	if s.ac != nil {
+		return s.ac.matchString(str), nil
+	}
+
+	var match func(s, needle string) bool
+	switch s.Op {
+	case "contains":
+		match = strings.Contains
+	case "hasPrefix":
+		match = strings.HasPrefix
+	case "hasSuffix":
+		match = strings.HasSuffix
+	default:
+		match = func(s, needle string) bool { return s == needle }
+	}
+
+	for _, needle := range s.needles {
+		if match(str, needle) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -2,6 +2,7 @@ package conditions
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/raphaelreyna/policyauthor"
 	"github.com/raphaelreyna/policyauthor/pkg/maputils"
@@ -16,13 +17,17 @@ func (s *SubstringSpec) String() string {
 	return fmt.Sprintf("[%s] SUBSTRING %+v", s.Key, s.Value)
 }
 
+func (s *SubstringSpec) ContextKeys() []string {
+	return []string{s.Key}
+}
+
 func (s *SubstringSpec) Evaluate(v map[string]any) (bool, error) {
 	if val, found := maputils.RecursiveGet(s.Key, v); found {
 		if val, ok := val.(string); ok {
-			return s.Value == val, nil
+			return strings.Contains(val, s.Value), nil
 		}
 
-		return false, fmt.Errorf("ContainSpec error: value at key %s is not a string, got %T", s.Key, val)
+		return false, fmt.Errorf("SubstringSpec error: value at key %s is not a string, got %T", s.Key, val)
 	}
 	return false, policyauthor.NewKeyNotFoundError(s.Key)
 }
@@ -1,7 +1,11 @@
 package conditions
 
 import (
+	"encoding/json"
 	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/raphaelreyna/policyauthor"
@@ -9,14 +13,26 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+// TimeSpec matches when the time at Key falls within the window described by Before and After.
+// Both bounds are exclusive and either one may be omitted.
+//
+// Bounds are either absolute times formatted according to Layout (RFC3339 by default),
+// or expressions relative to the current time such as "now", "now-24h" or "now+7d".
+// Absolute times and context strings without zone information are interpreted in Timezone (UTC by default).
+//
+// The value at Key may be a string formatted according to Layout, a time.Time,
+// or a number of seconds since the unix epoch.
 type TimeSpec struct {
-	Key    string `yaml:"key"`
-	Layout string `yaml:"layout"`
-	Before string `yaml:"before"`
-	After  string `yaml:"after"`
+	Key      string `yaml:"key"`
+	Layout   string `yaml:"layout"`
+	Before   string `yaml:"before"`
+	After    string `yaml:"after"`
+	Timezone string `yaml:"timezone"`
 
-	before time.Time `yaml:"-"`
-	after  time.Time `yaml:"-"`
+	before *timeExpr          `yaml:"-"`
+	after  *timeExpr          `yaml:"-"`
+	loc    *time.Location     `yaml:"-"`
+	clock  policyauthor.Clock `yaml:"-"`
 }
 
 func (s *TimeSpec) UnmarshalYAML(value *yaml.Node) error {
@@ -28,50 +44,249 @@ func (s *TimeSpec) UnmarshalYAML(value *yaml.Node) error {
 	}
 	*s = TimeSpec(t)
 
-	layout := time.RFC3339
-	if s.Layout != "" {
-		layout = s.Layout
+	if s.Before == "" && s.After == "" {
+		return fmt.Errorf("TimeSpec error: at least one of 'before' or 'after' must be set")
 	}
-	s.before, err = time.Parse(layout, s.Before)
-	if err != nil {
-		return fmt.Errorf("TimeSpec error: could not parse 'before' time: %s", err)
+
+	s.loc = time.UTC
+	if s.Timezone != "" {
+		if s.loc, err = time.LoadLocation(s.Timezone); err != nil {
+			return fmt.Errorf("TimeSpec error: could not load timezone %q: %s", s.Timezone, err)
+		}
 	}
 
-	s.after, err = time.Parse(time.RFC3339, s.After)
-	if err != nil {
-		return fmt.Errorf("TimeSpec error: could not parse 'after' time: %s", err)
+	if s.Before != "" {
+		if s.before, err = parseTimeExpr(s.Before, s.layout(), s.loc); err != nil {
+			return fmt.Errorf("TimeSpec error: could not parse 'before' time: %s", err)
+		}
+	}
+
+	if s.After != "" {
+		if s.after, err = parseTimeExpr(s.After, s.layout(), s.loc); err != nil {
+			return fmt.Errorf("TimeSpec error: could not parse 'after' time: %s", err)
+		}
 	}
 
 	return nil
 }
 
+func (s *TimeSpec) SetClock(c policyauthor.Clock) {
+	s.clock = c
+}
+
 func (s *TimeSpec) String() string {
 	switch {
 	case s.Before != "" && s.After != "":
-		return fmt.Sprintf("[%s] BETWEEN %s AND %s", s.Key, s.Before, s.After)
+		return fmt.Sprintf("[%s] BETWEEN %s AND %s", s.Key, s.After, s.Before)
 	case s.Before != "":
 		return fmt.Sprintf("[%s] BEFORE %s", s.Key, s.Before)
 	case s.After != "":
 		return fmt.Sprintf("[%s] AFTER %s", s.Key, s.After)
 	default:
-		return fmt.Sprintf("[%s] BETWEEN %s AND %s", s.Key, s.Before, s.After)
+		return fmt.Sprintf("[%s] BETWEEN %s AND %s", s.Key, s.After, s.Before)
 	}
 }
 
+func (s *TimeSpec) ContextKeys() []string {
+	return []string{s.Key}
+}
+
+// Volatile reports whether the outcome depends on the current time.
+func (s *TimeSpec) Volatile() bool {
+	return (s.before != nil && s.before.relative) || (s.after != nil && s.after.relative)
+}
+
 func (s *TimeSpec) Evaluate(v map[string]interface{}) (bool, error) {
-	layout := time.RFC3339
+	val, found := maputils.RecursiveGet(s.Key, v)
+	if !found {
+		return false, policyauthor.NewKeyNotFoundError(s.Key)
+	}
+
+	t, err := toTime(val, s.layout(), s.location())
+	if err != nil {
+		return false, fmt.Errorf("TimeSpec error: value at key %s: %s", s.Key, err)
+	}
+
+	now := s.now()
+	if s.before != nil && !t.Before(s.before.resolve(now)) {
+		return false, nil
+	}
+	if s.after != nil && !t.After(s.after.resolve(now)) {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func (s *TimeSpec) layout() string {
 	if s.Layout != "" {
-		layout = s.Layout
+		return s.Layout
+	}
+	return time.RFC3339
+}
+
+func (s *TimeSpec) location() *time.Location {
+	if s.loc == nil {
+		return time.UTC
+	}
+	return s.loc
+}
+
+func (s *TimeSpec) now() time.Time {
+	if s.clock == nil {
+		return policyauthor.SystemClock.Now()
+	}
+	return s.clock.Now()
+}
+
+// timeExpr is either an absolute time or an offset from the current time.
+type timeExpr struct {
+	abs      time.Time
+	relative bool
+	offset   time.Duration
+}
+
+func (e *timeExpr) resolve(now time.Time) time.Time {
+	if e.relative {
+		return now.Add(e.offset)
+	}
+	return e.abs
+}
+
+func parseTimeExpr(expr, layout string, loc *time.Location) (*timeExpr, error) {
+	expr = strings.TrimSpace(expr)
+	if rest, ok := strings.CutPrefix(expr, "now"); ok {
+		rest = strings.TrimSpace(rest)
+		if rest == "" {
+			return &timeExpr{relative: true}, nil
+		}
+
+		sign := time.Duration(1)
+		switch rest[0] {
+		case '+':
+		case '-':
+			sign = -1
+		default:
+			return nil, fmt.Errorf("invalid relative time %q: expected '+' or '-' after 'now'", expr)
+		}
+
+		d, err := parseDuration(strings.TrimSpace(rest[1:]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid relative time %q: %s", expr, err)
+		}
+
+		return &timeExpr{relative: true, offset: sign * d}, nil
+	}
+
+	t, err := time.ParseInLocation(layout, expr, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &timeExpr{abs: t}, nil
+}
+
+var durationSegmentRegex = regexp.MustCompile(`(\d+(?:\.\d+)?)(ns|us|µs|ms|s|m|h|d|w)`)
+
+// parseDuration extends time.ParseDuration with the 'd' (24h) and 'w' (7d) units.
+func parseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, fmt.Errorf("empty duration")
 	}
 
-	if val, found := maputils.RecursiveGet(s.Key, v); found {
-		if val, ok := val.(string); ok {
-			t, err := time.Parse(time.RFC3339, val)
+	var (
+		total time.Duration
+		pos   int
+	)
+	for _, m := range durationSegmentRegex.FindAllStringSubmatchIndex(s, -1) {
+		if m[0] != pos {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		pos = m[1]
+
+		n, unit := s[m[2]:m[3]], s[m[4]:m[5]]
+		switch unit {
+		case "d", "w":
+			f, err := strconv.ParseFloat(n, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q: %s", s, err)
+			}
+			day := 24 * time.Hour
+			if unit == "w" {
+				day *= 7
+			}
+			total += time.Duration(f * float64(day))
+		default:
+			d, err := time.ParseDuration(n + unit)
 			if err != nil {
-				return false, fmt.Errorf("TimeSpec error: value at key %s does not conform to the expected layout (%s): %s", s.Key, layout, err)
+				return 0, err
 			}
-			return s.before.Before(t) && s.after.After(t), nil
+			total += d
 		}
 	}
-	return false, policyauthor.NewKeyNotFoundError(s.Key)
+	if pos != len(s) {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+
+	return total, nil
+}
+
+// toTime converts a context value into a time.Time.
+// Numbers are interpreted as seconds since the unix epoch.
+func toTime(val any, layout string, loc *time.Location) (time.Time, error) {
+	switch v := val.(type) {
+	case time.Time:
+		return v, nil
+	case *time.Time:
+		if v == nil {
+			return time.Time{}, fmt.Errorf("nil time")
+		}
+		return *v, nil
+	case string:
+		t, err := time.ParseInLocation(layout, v, loc)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("does not conform to the expected layout (%s): %s", layout, err)
+		}
+		return t, nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return time.Unix(i, 0), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid unix time %q", v)
+		}
+		return unixFloat(f), nil
+	case int:
+		return time.Unix(int64(v), 0), nil
+	case int8:
+		return time.Unix(int64(v), 0), nil
+	case int16:
+		return time.Unix(int64(v), 0), nil
+	case int32:
+		return time.Unix(int64(v), 0), nil
+	case int64:
+		return time.Unix(v, 0), nil
+	case uint:
+		return time.Unix(int64(v), 0), nil
+	case uint8:
+		return time.Unix(int64(v), 0), nil
+	case uint16:
+		return time.Unix(int64(v), 0), nil
+	case uint32:
+		return time.Unix(int64(v), 0), nil
+	case uint64:
+		return time.Unix(int64(v), 0), nil
+	case float32:
+		return unixFloat(float64(v)), nil
+	case float64:
+		return unixFloat(v), nil
+	default:
+		return time.Time{}, fmt.Errorf("expected a string, time or unix timestamp, got %T", val)
+	}
+}
+
+func unixFloat(f float64) time.Time {
+	sec := int64(f)
+	return time.Unix(sec, int64((f-float64(sec))*float64(time.Second)))
 }
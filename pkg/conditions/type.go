@@ -0,0 +1,98 @@
+package conditions
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/raphaelreyna/policyauthor"
+	"github.com/raphaelreyna/policyauthor/pkg/maputils"
+	"gopkg.in/yaml.v3"
+)
+
+// TypeSpec matches when the dynamic type of the value at Key is one of Types.
+// Valid types are string, number, bool, list, map and null.
+// A single type may be given with Type.
+type TypeSpec struct {
+	Key   string   `yaml:"key"`
+	Type  string   `yaml:"type"`
+	Types []string `yaml:"types"`
+}
+
+func (s *TypeSpec) UnmarshalYAML(value *yaml.Node) error {
+	type T TypeSpec
+	var t T
+	if err := value.Decode(&t); err != nil {
+		return err
+	}
+	*s = TypeSpec(t)
+
+	if s.Type != "" {
+		s.Types = append([]string{s.Type}, s.Types...)
+	}
+	if len(s.Types) == 0 {
+		return fmt.Errorf("TypeSpec error: no types set")
+	}
+
+	for _, t := range s.Types {
+		switch t {
+		case "string", "number", "bool", "list", "map", "null":
+		default:
+			return fmt.Errorf("TypeSpec error: unknown type %q", t)
+		}
+	}
+
+	return nil
+}
+
+func (s *TypeSpec) String() string {
+	return fmt.Sprintf("[%s] IS %s", s.Key, strings.Join(s.Types, " OR "))
+}
+
+func (s *TypeSpec) ContextKeys() []string {
+	return []string{s.Key}
+}
+
+func (s *TypeSpec) Evaluate(v map[string]any) (bool, error) {
+	val, found := maputils.RecursiveGet(s.Key, v)
+	if !found {
+		return false, policyauthor.NewKeyNotFoundError(s.Key)
+	}
+
+	t := typeName(val)
+	for _, x := range s.Types {
+		if x == t {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// typeName returns the TypeSpec name of the dynamic type of val, or an empty string if it has none.
+func typeName(val any) string {
+	if val == nil {
+		return "null"
+	}
+	if _, ok := toNumber(val, false); ok {
+		return "number"
+	}
+
+	switch rv := reflect.ValueOf(val); rv.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "bool"
+	case reflect.Slice, reflect.Array:
+		return "list"
+	case reflect.Map:
+		return "map"
+	case reflect.Float32, reflect.Float64:
+		// NaN is rejected by toNumber but is still a number.
+		return "number"
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return "null"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,233 @@
+// Package decisionlog records the decisions of a policy engine as JSON lines or log/slog records,
+// with sampling and redaction of the evaluation context.
+package decisionlog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/raphaelreyna/policyauthor"
+	"github.com/raphaelreyna/policyauthor/pkg/hashutils"
+)
+
+// Redaction actions.
+const (
+	// Mask replaces the value with Masked.
+	Mask = "mask"
+	// Hash replaces the value with a salted hash of it, so that equal values can still be correlated.
+	Hash = "hash"
+	// Drop removes the value.
+	Drop = "drop"
+)
+
+// Masked replaces masked values.
+const Masked = "[REDACTED]"
+
+// Rule redacts the value at Key, a dot separated path into the evaluation context such as headers.Authorization.
+type Rule struct {
+	Key    string `yaml:"key" json:"key"`
+	Action string `yaml:"action" json:"action"`
+}
+
+// Options configure a Logger.
+type Options struct {
+	// SampleRate is the fraction of decisions that are logged.
+	// Values outside of (0, 1) log every decision. Failed evaluations are always logged.
+	SampleRate float64
+	// Rand is the source used for sampling, policyauthor.SystemRand by default.
+	Rand policyauthor.RandSource
+	// Redact lists the redaction rules applied to the context of every record.
+	// The decision value is not redacted.
+	Redact []Rule
+	// Salt is hashed together with values redacted with the Hash action.
+	Salt string
+	// Level is the level of slog records, failed evaluations are logged at slog.LevelError.
+	Level slog.Level
+}
+
+// Logger is a policyauthor.DecisionLogger.
+type Logger struct {
+	opts Options
+	emit func(r *policyauthor.DecisionRecord, ctx map[string]any)
+}
+
+var _ policyauthor.DecisionLogger = (*Logger)(nil)
+
+// NewJSON returns a Logger writing one JSON object per decision to w.
+func NewJSON(w io.Writer, opts Options) (*Logger, error) {
+	l, err := newLogger(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	l.emit = func(r *policyauthor.DecisionRecord, ctx map[string]any) {
+		b, err := json.Marshal(newEntry(r, ctx))
+		if err != nil {
+			// Fall back to the printed representation of values that cannot be encoded.
+			e := newEntry(r, stringify(ctx))
+			e.Value = fmt.Sprint(r.Value)
+			if b, err = json.Marshal(e); err != nil {
+				return
+			}
+		}
+		b = append(b, '\n')
+
+		mu.Lock()
+		defer mu.Unlock()
+		w.Write(b)
+	}
+
+	return l, nil
+}
+
+// NewSlog returns a Logger emitting a "decision" record per decision to h.
+func NewSlog(h slog.Handler, opts Options) (*Logger, error) {
+	l, err := newLogger(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	l.emit = func(r *policyauthor.DecisionRecord, ctx map[string]any) {
+		level := l.opts.Level
+		if r.Err != nil {
+			level = slog.LevelError
+		}
+		if !h.Enabled(context.Background(), level) {
+			return
+		}
+
+		rec := slog.NewRecord(r.Time, level, "decision", 0)
+		rec.AddAttrs(
+			slog.String("engine_version", r.EngineVersion),
+			slog.String("policy", r.Policy),
+			slog.Int("policy_index", r.PolicyIndex),
+			slog.Bool("hit", r.Hit),
+			slog.Any("value", r.Value),
+			slog.Any("context", ctx),
+			slog.Duration("duration", r.Duration),
+		)
+		if r.Err != nil {
+			rec.AddAttrs(slog.String("error", r.Err.Error()))
+		}
+		h.Handle(context.Background(), rec)
+	}
+
+	return l, nil
+}
+
+func newLogger(opts Options) (*Logger, error) {
+	for _, r := range opts.Redact {
+		switch r.Action {
+		case Mask, Hash, Drop:
+		default:
+			return nil, fmt.Errorf("unknown redaction action %q for key %s", r.Action, r.Key)
+		}
+		if r.Key == "" {
+			return nil, fmt.Errorf("redaction rule without a key")
+		}
+	}
+	if opts.Rand == nil {
+		opts.Rand = policyauthor.SystemRand
+	}
+
+	return &Logger{opts: opts}, nil
+}
+
+func (l *Logger) LogDecision(r *policyauthor.DecisionRecord) {
+	if r.Err == nil && l.opts.SampleRate > 0 && l.opts.SampleRate < 1 && l.opts.Rand.Float64() >= l.opts.SampleRate {
+		return
+	}
+
+	l.emit(r, l.redact(r.Context))
+}
+
+// redact returns a copy of ctx with the redaction rules applied.
+// Nested maps are copied as they are modified, ctx is left untouched.
+func (l *Logger) redact(ctx map[string]any) map[string]any {
+	if len(l.opts.Redact) == 0 || len(ctx) == 0 {
+		return ctx
+	}
+
+	ctx = maps.Clone(ctx)
+	for _, r := range l.opts.Redact {
+		l.apply(r, ctx, r.Key)
+	}
+	return ctx
+}
+
+// apply redacts the value at path in m, which must be a copy owned by the caller.
+func (l *Logger) apply(r Rule, m map[string]any, path string) {
+	if v, ok := m[path]; ok {
+		switch r.Action {
+		case Mask:
+			m[path] = Masked
+		case Hash:
+			m[path] = fmt.Sprintf("%016x", hashutils.Hash(l.opts.Salt, fmt.Sprint(v)))
+		case Drop:
+			delete(m, path)
+		}
+	}
+
+	for k, v := range m {
+		rest := path
+		if k != "" {
+			var ok bool
+			if rest, ok = strings.CutPrefix(path, k+"."); !ok {
+				continue
+			}
+		}
+
+		sub, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+		sub = maps.Clone(sub)
+		l.apply(r, sub, rest)
+		m[k] = sub
+	}
+}
+
+type entry struct {
+	Time          time.Time      `json:"time"`
+	EngineVersion string         `json:"engine_version,omitempty"`
+	Policy        string         `json:"policy,omitempty"`
+	PolicyIndex   int            `json:"policy_index"`
+	Hit           bool           `json:"hit"`
+	Value         any            `json:"value,omitempty"`
+	Error         string         `json:"error,omitempty"`
+	Context       map[string]any `json:"context,omitempty"`
+	DurationMS    float64        `json:"duration_ms"`
+}
+
+func newEntry(r *policyauthor.DecisionRecord, ctx map[string]any) *entry {
+	e := &entry{
+		Time:          r.Time,
+		EngineVersion: r.EngineVersion,
+		Policy:        r.Policy,
+		PolicyIndex:   r.PolicyIndex,
+		Hit:           r.Hit,
+		Value:         r.Value,
+		Context:       ctx,
+		DurationMS:    float64(r.Duration.Microseconds()) / 1000,
+	}
+	if r.Err != nil {
+		e.Error = r.Err.Error()
+	}
+	return e
+}
+
+func stringify(ctx map[string]any) map[string]any {
+	out := make(map[string]any, len(ctx))
+	for k, v := range ctx {
+		out[k] = fmt.Sprint(v)
+	}
+	return out
+}
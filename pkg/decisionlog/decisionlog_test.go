@@ -0,0 +1,144 @@
+package decisionlog_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raphaelreyna/policyauthor"
+	"github.com/raphaelreyna/policyauthor/pkg/conditions"
+	"github.com/raphaelreyna/policyauthor/pkg/decisionlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+const conf = `
+policies:
+- name: internal
+  value: internal
+  conditions:
+  - type: cidr
+    spec:
+      key: "remote_addr"
+      value: "10.0.0.0/8"
+- value: authenticated
+  conditions:
+  - type: exists
+    spec:
+      key: "headers.Authorization"
+  - type: equal
+    spec:
+      key: "user.email"
+      value: "admin@example.com"
+`
+
+func load(t *testing.T, l policyauthor.DecisionLogger) *policyauthor.PolicyEngine {
+	policyauthor.RegisterConditions(conditions.AllConditionsMap())
+
+	p := struct {
+		Policies *policyauthor.PolicyEngine `yaml:"policies"`
+	}{}
+	err := yaml.Unmarshal([]byte(conf), &p)
+	require.NoError(t, err)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	p.Policies.SetClock(policyauthor.ClockFunc(func() time.Time { return now }))
+	p.Policies.SetDecisionLogger(l)
+	return p.Policies
+}
+
+func TestJSON(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := decisionlog.NewJSON(&buf, decisionlog.Options{
+		Redact: []decisionlog.Rule{
+			{Key: "headers.Authorization", Action: decisionlog.Mask},
+			{Key: "user.email", Action: decisionlog.Hash},
+		},
+	})
+	require.NoError(t, err)
+
+	engine := load(t, l)
+	engine.SetVersion("v1")
+
+	headers := map[string]any{"Authorization": "Bearer secret", "Accept": "*/*"}
+	evaluationContext := map[string]any{
+		"remote_addr": "192.168.0.1",
+		"headers":     headers,
+		"user":        map[string]any{"email": "admin@example.com"},
+		"unrelated":   true,
+	}
+	_, hit, err := engine.Evaluate(evaluationContext)
+	require.NoError(t, err)
+	require.True(t, hit)
+
+	_, _, err = engine.Evaluate(map[string]any{"remote_addr": "10.1.2.3"})
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var rec map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &rec))
+	assert.Equal(t, "2024-01-01T00:00:00Z", rec["time"])
+	assert.Equal(t, "v1", rec["engine_version"])
+	assert.Equal(t, "1", rec["policy"])
+	assert.Equal(t, "authenticated", rec["value"])
+
+	ctx := rec["context"].(map[string]any)
+	assert.Equal(t, "192.168.0.1", ctx["remote_addr"])
+	assert.Equal(t, decisionlog.Masked, ctx["headers.Authorization"])
+	assert.Len(t, ctx["user.email"], 16)
+	assert.NotEqual(t, "admin@example.com", ctx["user.email"])
+	assert.NotContains(t, ctx, "unrelated")
+
+	// The evaluation context is left untouched.
+	assert.Equal(t, "Bearer secret", headers["Authorization"])
+
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &rec))
+	assert.Equal(t, "internal", rec["policy"])
+	assert.Equal(t, map[string]any{"remote_addr": "10.1.2.3"}, rec["context"])
+}
+
+func TestSlogSampling(t *testing.T) {
+	var buf bytes.Buffer
+	draws := []float64{0.9, 0.1, 0.1}
+	l, err := decisionlog.NewSlog(slog.NewJSONHandler(&buf, nil), decisionlog.Options{
+		SampleRate: 0.5,
+		Rand: policyauthor.RandFunc(func() float64 {
+			f := draws[0]
+			draws = draws[1:]
+			return f
+		}),
+		Redact: []decisionlog.Rule{{Key: "headers.Authorization", Action: decisionlog.Drop}},
+	})
+	require.NoError(t, err)
+
+	engine := load(t, l)
+	evaluationContext := map[string]any{"remote_addr": "10.0.0.1"}
+	engine.Evaluate(evaluationContext)
+	engine.Evaluate(evaluationContext)
+	engine.Evaluate(map[string]any{"remote_addr": "192.168.0.1", "headers": map[string]any{"Authorization": "x"}})
+	// Errors are always logged.
+	engine.Evaluate(map[string]any{"remote_addr": "192.168.0.1"})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3)
+
+	var rec map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &rec))
+	assert.Equal(t, "INFO", rec["level"])
+	assert.Equal(t, "authenticated", rec["value"])
+	assert.NotContains(t, rec["context"], "headers.Authorization")
+	assert.NotEmpty(t, rec["engine_version"])
+
+	require.NoError(t, json.Unmarshal([]byte(lines[2]), &rec))
+	assert.Equal(t, "ERROR", rec["level"])
+	assert.Contains(t, rec["error"], "user.email")
+
+	_, err = decisionlog.NewJSON(&buf, decisionlog.Options{Redact: []decisionlog.Rule{{Key: "a", Action: "encrypt"}}})
+	assert.Error(t, err)
+}
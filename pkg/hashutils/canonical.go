@@ -0,0 +1,75 @@
+package hashutils
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Canonical returns a canonical string for a scalar value, so that numerically equal values
+// of different Go types, such as int64(8080), float64(8080) and json.Number("8080"), hash identically.
+// Integral numbers are written as decimal integers and other numbers in the shortest form that parses back to them.
+func Canonical(val any) (string, error) {
+	switch v := val.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int8:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int16:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case uintptr:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case float32:
+		return canonicalFloat(float64(v))
+	case float64:
+		return canonicalFloat(v)
+	case json.Number:
+		s := strings.TrimSpace(string(v))
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return strconv.FormatInt(i, 10), nil
+		}
+		if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+			return strconv.FormatUint(u, 10), nil
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return canonicalFloat(f)
+		}
+		return "", fmt.Errorf("%q is not a number", s)
+	}
+	return "", fmt.Errorf("%T cannot be hashed", val)
+}
+
+func canonicalFloat(f float64) (string, error) {
+	if math.IsNaN(f) {
+		return "", fmt.Errorf("NaN cannot be hashed")
+	}
+	if f == math.Trunc(f) {
+		switch {
+		case f >= 0 && f < math.Exp2(64):
+			return strconv.FormatUint(uint64(f), 10), nil
+		case f < 0 && f >= -math.Exp2(63):
+			return strconv.FormatInt(int64(f), 10), nil
+		}
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64), nil
+}
@@ -0,0 +1,24 @@
+package hashutils
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// Hash returns a 64 bit hash of salt and values that is stable across processes and releases.
+func Hash(salt string, values ...string) uint64 {
+	h := sha256.New()
+	h.Write([]byte(salt))
+	for _, v := range values {
+		h.Write([]byte{0})
+		h.Write([]byte(v))
+	}
+
+	sum := h.Sum(nil)
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// Fraction maps a hash onto [0, 1).
+func Fraction(h uint64) float64 {
+	return float64(h>>11) / (1 << 53)
+}
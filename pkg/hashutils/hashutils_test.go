@@ -0,0 +1,42 @@
+package hashutils
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonical(t *testing.T) {
+	groups := [][]any{
+		{8080, int64(8080), uint16(8080), float32(8080), float64(8080), json.Number("8080"), json.Number("8080.0")},
+		{int64(1 << 60), uint64(1 << 60), float64(1 << 60), json.Number("1152921504606846976"), json.Number("1.152921504606846976e18")},
+		{int64(-1 << 63), float64(-1 << 63)},
+		{uint64(math.MaxUint64), json.Number("18446744073709551615")},
+		{0.5, float32(0.5), json.Number("0.5")},
+		{1e300, json.Number("1e300")},
+		{true},
+		{"8080"},
+	}
+
+	for _, group := range groups {
+		want, err := Canonical(group[0])
+		require.NoError(t, err)
+		for _, v := range group[1:] {
+			got, err := Canonical(v)
+			require.NoError(t, err)
+			assert.Equal(t, want, got, "%T %v", v, v)
+		}
+	}
+
+	s, err := Canonical(float64(1 << 60))
+	require.NoError(t, err)
+	assert.Equal(t, "1152921504606846976", s)
+
+	for _, v := range []any{math.NaN(), json.Number("abc"), []any{1}, nil} {
+		_, err := Canonical(v)
+		assert.Error(t, err, "%v", v)
+	}
+}
@@ -0,0 +1,125 @@
+package httpctx
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// FromRequest builds the canonical evaluation context for r:
+//
+//	method          request method
+//	scheme          http or https
+//	proto           protocol version, e.g. HTTP/1.1
+//	host            host header, including the port if any
+//	hostname        host without the port
+//	port            port from the host header, empty if none
+//	path            URL path
+//	raw_query       encoded query string
+//	query           first value of each query parameter
+//	query_values    all values of each query parameter
+//	headers         first value of each header, by canonical name (User-Agent)
+//	header_values   all values of each header, by canonical name
+//	cookies         value of each cookie, by name
+//	remote_addr     client IP address, without the port
+//	remote_port     client port
+//	content_length  request body length, -1 if unknown
+//	tls             connection details for TLS requests only, see tlsContext
+//
+// Maps are map[string]any and lists []any, so that every key can be reached by conditions.
+func FromRequest(r *http.Request) map[string]any {
+	ctx := map[string]any{
+		"method":         r.Method,
+		"scheme":         "http",
+		"proto":          r.Proto,
+		"host":           r.Host,
+		"path":           r.URL.Path,
+		"raw_query":      r.URL.RawQuery,
+		"content_length": r.ContentLength,
+	}
+
+	hostname, port := r.Host, ""
+	if h, p, err := net.SplitHostPort(r.Host); err == nil {
+		hostname, port = h, p
+	}
+	ctx["hostname"] = strings.Trim(hostname, "[]")
+	ctx["port"] = port
+
+	query, queryValues := map[string]any{}, map[string]any{}
+	for k, vs := range r.URL.Query() {
+		query[k] = vs[0]
+		queryValues[k] = toList(vs)
+	}
+	ctx["query"], ctx["query_values"] = query, queryValues
+
+	headers, headerValues := map[string]any{}, map[string]any{}
+	for k, vs := range r.Header {
+		k = http.CanonicalHeaderKey(k)
+		if len(vs) > 0 {
+			headers[k] = vs[0]
+		}
+		headerValues[k] = toList(vs)
+	}
+	ctx["headers"], ctx["header_values"] = headers, headerValues
+
+	cookies := map[string]any{}
+	for _, c := range r.Cookies() {
+		if _, ok := cookies[c.Name]; !ok {
+			cookies[c.Name] = c.Value
+		}
+	}
+	ctx["cookies"] = cookies
+
+	remoteAddr, remotePort := r.RemoteAddr, ""
+	if h, p, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		remoteAddr, remotePort = h, p
+	}
+	ctx["remote_addr"], ctx["remote_port"] = remoteAddr, remotePort
+
+	if r.TLS != nil {
+		ctx["scheme"] = "https"
+		ctx["tls"] = tlsContext(r.TLS)
+	}
+
+	return ctx
+}
+
+// tlsContext describes a TLS connection:
+//
+//	version              e.g. TLS 1.3
+//	cipher_suite         e.g. TLS_AES_128_GCM_SHA256
+//	server_name          SNI server name
+//	negotiated_protocol  ALPN protocol, e.g. h2
+//	client_verified      whether a client certificate chain was verified
+//	peer_certificates    subject, issuer, serial and DNS names of each peer certificate, leaf first
+func tlsContext(cs *tls.ConnectionState) map[string]any {
+	certs := make([]any, len(cs.PeerCertificates))
+	for i, c := range cs.PeerCertificates {
+		certs[i] = map[string]any{
+			"subject":     c.Subject.String(),
+			"common_name": c.Subject.CommonName,
+			"issuer":      c.Issuer.String(),
+			"serial":      c.SerialNumber.String(),
+			"dns_names":   toList(c.DNSNames),
+			"not_after":   c.NotAfter,
+		}
+	}
+
+	return map[string]any{
+		"version":             tls.VersionName(cs.Version),
+		"cipher_suite":        tls.CipherSuiteName(cs.CipherSuite),
+		"server_name":         cs.ServerName,
+		"negotiated_protocol": cs.NegotiatedProtocol,
+		"client_verified":     len(cs.VerifiedChains) > 0,
+		"peer_certificates":   certs,
+	}
+}
+
+func toList(vs []string) []any {
+	l := make([]any, len(vs))
+	for i, v := range vs {
+		l[i] = v
+	}
+	return l
+}
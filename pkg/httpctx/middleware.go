@@ -0,0 +1,58 @@
+package httpctx
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/raphaelreyna/policyauthor"
+)
+
+// Decision is the outcome of evaluating a PolicyEngine against a request.
+type Decision struct {
+	Value any
+	Hit   bool
+	Err   error
+	// Context is the evaluation context the decision was made against.
+	Context map[string]any
+}
+
+type decisionKey struct{}
+
+// NewContext returns a copy of ctx carrying d.
+func NewContext(ctx context.Context, d *Decision) context.Context {
+	return context.WithValue(ctx, decisionKey{}, d)
+}
+
+// DecisionFromContext returns the decision stored in ctx by Middleware, if any.
+func DecisionFromContext(ctx context.Context) (*Decision, bool) {
+	d, ok := ctx.Value(decisionKey{}).(*Decision)
+	return d, ok
+}
+
+// Middleware evaluates engine against the context built by FromRequest for every request,
+// and stores the decision in the request context for next to retrieve with DecisionFromContext.
+// Evaluation errors are stored in the decision, it is up to next to act on them.
+func Middleware(engine *policyauthor.PolicyEngine) func(next http.Handler) http.Handler {
+	return MiddlewareFunc(engine, FromRequest)
+}
+
+// MiddlewareFunc is like Middleware, building evaluation contexts with contextFunc.
+func MiddlewareFunc(engine *policyauthor.PolicyEngine, contextFunc func(r *http.Request) map[string]any) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			d := Evaluate(engine, contextFunc(r))
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), d)))
+		})
+	}
+}
+
+// Evaluate evaluates engine against evaluationContext and wraps the outcome in a Decision.
+func Evaluate(engine *policyauthor.PolicyEngine, evaluationContext map[string]any) *Decision {
+	value, hit, err := engine.Evaluate(evaluationContext)
+	return &Decision{
+		Value:   value,
+		Hit:     hit,
+		Err:     err,
+		Context: evaluationContext,
+	}
+}
@@ -0,0 +1,77 @@
+package httpctx_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/raphaelreyna/policyauthor"
+	"github.com/raphaelreyna/policyauthor/pkg/conditions"
+	"github.com/raphaelreyna/policyauthor/pkg/httpctx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestFromRequest(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "http://api.example.com:8443/v1/users?id=1&id=2", nil)
+	r.RemoteAddr = "192.168.2.1:51234"
+	r.Header.Add("x-forwarded-for", "10.0.0.1")
+	r.Header.Add("X-Forwarded-For", "10.0.0.2")
+	r.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+
+	ctx := httpctx.FromRequest(r)
+	assert.Equal(t, "GET", ctx["method"])
+	assert.Equal(t, "http", ctx["scheme"])
+	assert.Equal(t, "api.example.com", ctx["hostname"])
+	assert.Equal(t, "8443", ctx["port"])
+	assert.Equal(t, "/v1/users", ctx["path"])
+	assert.Equal(t, "1", ctx["query"].(map[string]any)["id"])
+	assert.Equal(t, []any{"1", "2"}, ctx["query_values"].(map[string]any)["id"])
+	assert.Equal(t, "10.0.0.1", ctx["headers"].(map[string]any)["X-Forwarded-For"])
+	assert.Equal(t, []any{"10.0.0.1", "10.0.0.2"}, ctx["header_values"].(map[string]any)["X-Forwarded-For"])
+	assert.Equal(t, "abc", ctx["cookies"].(map[string]any)["session"])
+	assert.Equal(t, "192.168.2.1", ctx["remote_addr"])
+	assert.NotContains(t, ctx, "tls")
+}
+
+func TestMiddleware(t *testing.T) {
+	policyauthor.RegisterConditions(conditions.AllConditionsMap())
+
+	conf := `
+policies:
+- value: "https://mozilla.mysite.com"
+  conditions:
+  - type: regex
+    spec:
+      key: "headers.User-Agent"
+      pattern: "^Mozilla/5.0.*"
+`
+
+	p := struct {
+		Policies *policyauthor.PolicyEngine `yaml:"policies"`
+	}{
+		Policies: &policyauthor.PolicyEngine{},
+	}
+	require.NoError(t, yaml.Unmarshal([]byte(conf), &p))
+
+	var decision *httpctx.Decision
+	h := httpctx.Middleware(p.Policies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ok bool
+		decision, ok = httpctx.DecisionFromContext(r.Context())
+		require.True(t, ok)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64)")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	assert.NoError(t, decision.Err)
+	assert.True(t, decision.Hit)
+	assert.Equal(t, "https://mozilla.mysite.com", decision.Value)
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("User-Agent", "curl/8.0")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	assert.NoError(t, decision.Err)
+	assert.False(t, decision.Hit)
+}
@@ -0,0 +1,16 @@
+package metrics
+
+import "expvar"
+
+// Var returns an expvar.Var reporting the Snapshot of c as JSON.
+func (c *Collector) Var() expvar.Var {
+	return expvar.Func(func() any {
+		return c.Snapshot()
+	})
+}
+
+// Publish publishes the statistics of c under name on the expvar endpoint.
+// Like expvar.Publish, it panics if name is already in use.
+func (c *Collector) Publish(name string) {
+	expvar.Publish(name, c.Var())
+}
@@ -0,0 +1,156 @@
+// Package metrics collects statistics about policy engine evaluations
+// and exposes them through expvar or in the Prometheus text format.
+package metrics
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"sync"
+
+	"github.com/raphaelreyna/policyauthor"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the default evaluation latency histogram buckets.
+var DefaultBuckets = []float64{.00001, .000025, .00005, .0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1}
+
+// Error types reported by ErrorType.
+const (
+	ErrorTypeKeyNotFound  = "key_not_found"
+	ErrorTypeEmptyContext = "empty_context"
+	ErrorTypeOther        = "other"
+)
+
+// ErrorType classifies an evaluation error.
+func ErrorType(err error) string {
+	switch {
+	case errors.Is(err, policyauthor.ErrKeyNotFound):
+		return ErrorTypeKeyNotFound
+	case errors.Is(err, policyauthor.ErrEmptyContext):
+		return ErrorTypeEmptyContext
+	default:
+		return ErrorTypeOther
+	}
+}
+
+// Collector is an in-memory implementation of policyauthor.Metrics.
+// It counts evaluations, hits per policy, misses and errors per type, and keeps a histogram of evaluation latencies.
+type Collector struct {
+	buckets []float64
+
+	mu          sync.Mutex
+	evaluations uint64
+	misses      uint64
+	hits        map[string]uint64
+	errors      map[string]uint64
+	// counts[i] is the number of evaluations that took at most buckets[i], counts[len(buckets)] counts the rest.
+	counts []uint64
+	sum    float64
+}
+
+// New returns a Collector using the given histogram bucket upper bounds in seconds, or DefaultBuckets if none are given.
+func New(buckets ...float64) *Collector {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	// The +Inf bucket is implicit.
+	buckets = slices.DeleteFunc(slices.Clone(buckets), func(b float64) bool { return math.IsInf(b, 1) || math.IsNaN(b) })
+	slices.Sort(buckets)
+	buckets = slices.Compact(buckets)
+
+	return &Collector{
+		buckets: buckets,
+		hits:    map[string]uint64{},
+		errors:  map[string]uint64{},
+		counts:  make([]uint64, len(buckets)+1),
+	}
+}
+
+func (c *Collector) ObserveEvaluation(o policyauthor.Observation) {
+	seconds := o.Duration.Seconds()
+	i, _ := slices.BinarySearch(c.buckets, seconds)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.evaluations++
+	switch {
+	case o.Err != nil:
+		c.errors[ErrorType(o.Err)]++
+	case o.Hit:
+		c.hits[o.Policy]++
+	default:
+		c.misses++
+	}
+	c.counts[i]++
+	c.sum += seconds
+}
+
+// Snapshot is a point in time copy of the statistics of a Collector.
+type Snapshot struct {
+	Evaluations uint64            `json:"evaluations"`
+	Misses      uint64            `json:"misses"`
+	Hits        map[string]uint64 `json:"hits"`
+	Errors      map[string]uint64 `json:"errors"`
+	Latency     Histogram         `json:"latency"`
+}
+
+// Histogram is a cumulative histogram of evaluation latencies in seconds.
+type Histogram struct {
+	Buckets []Bucket `json:"buckets"`
+	Count   uint64   `json:"count"`
+	Sum     float64  `json:"sum"`
+}
+
+// Bucket counts the observations less than or equal to UpperBound.
+type Bucket struct {
+	UpperBound float64 `json:"le"`
+	Count      uint64  `json:"count"`
+}
+
+// Snapshot returns a copy of the current statistics.
+func (c *Collector) Snapshot() Snapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := Snapshot{
+		Evaluations: c.evaluations,
+		Misses:      c.misses,
+		Hits:        make(map[string]uint64, len(c.hits)),
+		Errors:      make(map[string]uint64, len(c.errors)),
+		Latency: Histogram{
+			Buckets: make([]Bucket, len(c.buckets)),
+			Count:   c.evaluations,
+			Sum:     c.sum,
+		},
+	}
+	for k, v := range c.hits {
+		s.Hits[k] = v
+	}
+	for k, v := range c.errors {
+		s.Errors[k] = v
+	}
+
+	var cumulative uint64
+	for i, ub := range c.buckets {
+		cumulative += c.counts[i]
+		s.Latency.Buckets[i] = Bucket{UpperBound: ub, Count: cumulative}
+	}
+
+	return s
+}
+
+// Reset zeroes every statistic.
+func (c *Collector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.evaluations = 0
+	c.misses = 0
+	c.hits = map[string]uint64{}
+	c.errors = map[string]uint64{}
+	c.counts = make([]uint64, len(c.buckets)+1)
+	c.sum = 0
+}
+
+var _ policyauthor.Metrics = (*Collector)(nil)
@@ -0,0 +1,85 @@
+package metrics_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/raphaelreyna/policyauthor"
+	"github.com/raphaelreyna/policyauthor/pkg/conditions"
+	"github.com/raphaelreyna/policyauthor/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestCollector(t *testing.T) {
+	policyauthor.RegisterConditions(conditions.AllConditionsMap())
+
+	conf := `
+policies:
+- name: admin
+  value: admin
+  conditions:
+  - type: equal
+    spec:
+      key: "role"
+      value: "admin"
+- value: user
+  conditions:
+  - type: equal
+    spec:
+      key: "role"
+      value: "user"
+- value: legacy
+  conditions:
+  - type: exists
+    spec:
+      key: "legacy"
+`
+
+	p := struct {
+		Policies *policyauthor.PolicyEngine `yaml:"policies"`
+	}{}
+	err := yaml.Unmarshal([]byte(conf), &p)
+	require.NoError(t, err)
+
+	c := metrics.New()
+	p.Policies.SetMetrics(c)
+
+	for _, ctx := range []map[string]any{
+		{"role": "admin"},
+		{"role": "admin"},
+		{"role": "user"},
+		{"role": "guest", "legacy": true},
+		{"role": "guest"},
+		{"legacy": true},
+		{},
+	} {
+		p.Policies.Evaluate(ctx)
+	}
+
+	s := c.Snapshot()
+	assert.Equal(t, uint64(7), s.Evaluations)
+	assert.Equal(t, map[string]uint64{"admin": 2, "1": 1, "2": 1}, s.Hits)
+	assert.Equal(t, uint64(1), s.Misses)
+	assert.Equal(t, map[string]uint64{metrics.ErrorTypeKeyNotFound: 1, metrics.ErrorTypeEmptyContext: 1}, s.Errors)
+	assert.Equal(t, uint64(7), s.Latency.Count)
+
+	var fromVar metrics.Snapshot
+	require.NoError(t, json.Unmarshal([]byte(c.Var().String()), &fromVar))
+	assert.Equal(t, s.Hits, fromVar.Hits)
+
+	w := httptest.NewRecorder()
+	c.Handler("").ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+	assert.Contains(t, body, "# TYPE policyauthor_evaluations_total counter\npolicyauthor_evaluations_total 7\n")
+	assert.Contains(t, body, `policyauthor_policy_hits_total{policy="admin"} 2`)
+	assert.Contains(t, body, `policyauthor_errors_total{type="key_not_found"} 1`)
+	assert.Contains(t, body, `policyauthor_evaluation_duration_seconds_bucket{le="+Inf"} 7`)
+	assert.Contains(t, body, "policyauthor_evaluation_duration_seconds_count 7\n")
+
+	c.Reset()
+	assert.Equal(t, uint64(0), c.Snapshot().Evaluations)
+}
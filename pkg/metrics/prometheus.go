@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultNamespace prefixes the names of the metrics written by WritePrometheus.
+const DefaultNamespace = "policyauthor"
+
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Handler returns an http.Handler serving the statistics of c in the Prometheus text exposition format,
+// with metric names prefixed by namespace, or DefaultNamespace if it is empty.
+func (c *Collector) Handler(namespace string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", prometheusContentType)
+		if err := c.WritePrometheus(w, namespace); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// WritePrometheus writes the statistics of c to w in the Prometheus text exposition format,
+// with metric names prefixed by namespace, or DefaultNamespace if it is empty.
+func (c *Collector) WritePrometheus(w io.Writer, namespace string) error {
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	s := c.Snapshot()
+	bw := bufio.NewWriter(w)
+
+	name := namespace + "_evaluations_total"
+	writeHeader(bw, name, "counter", "Number of policy engine evaluations.")
+	fmt.Fprintf(bw, "%s %d\n", name, s.Evaluations)
+
+	name = namespace + "_policy_hits_total"
+	writeHeader(bw, name, "counter", "Number of evaluations hitting each policy.")
+	for _, k := range sortedKeys(s.Hits) {
+		fmt.Fprintf(bw, "%s{policy=\"%s\"} %d\n", name, escapeLabel(k), s.Hits[k])
+	}
+
+	name = namespace + "_misses_total"
+	writeHeader(bw, name, "counter", "Number of evaluations hitting no policy.")
+	fmt.Fprintf(bw, "%s %d\n", name, s.Misses)
+
+	name = namespace + "_errors_total"
+	writeHeader(bw, name, "counter", "Number of failed evaluations by error type.")
+	for _, k := range sortedKeys(s.Errors) {
+		fmt.Fprintf(bw, "%s{type=\"%s\"} %d\n", name, escapeLabel(k), s.Errors[k])
+	}
+
+	name = namespace + "_evaluation_duration_seconds"
+	writeHeader(bw, name, "histogram", "Evaluation latency in seconds.")
+	for _, b := range s.Latency.Buckets {
+		fmt.Fprintf(bw, "%s_bucket{le=\"%s\"} %d\n", name, formatFloat(b.UpperBound), b.Count)
+	}
+	fmt.Fprintf(bw, "%s_bucket{le=\"+Inf\"} %d\n", name, s.Latency.Count)
+	fmt.Fprintf(bw, "%s_sum %s\n", name, formatFloat(s.Latency.Sum))
+	fmt.Fprintf(bw, "%s_count %d\n", name, s.Latency.Count)
+
+	return bw.Flush()
+}
+
+func writeHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
+
+func sortedKeys(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
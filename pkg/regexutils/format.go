@@ -0,0 +1,48 @@
+package regexutils
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Format takes a compiled regex, a target string, and a format string.
+// It replaces placeholders like \1, \2, etc., in the format string with the corresponding matched groups.
+func Format(regex *regexp.Regexp, target, format string) string {
+	matches := regex.FindStringSubmatch(target)
+	if len(matches) == 0 {
+		return "" // No match found
+	}
+	if matches[0] == "" {
+		return "" // No match found
+	}
+
+	// Split the format string and replace placeholders with the matched groups.
+	result := strings.Builder{}
+	lastPos := 0
+	for i := 0; i < len(format)-1; i++ {
+		if format[i] == '\\' && '1' <= format[i+1] && format[i+1] <= '9' {
+			// Append the part before the placeholder
+			result.WriteString(format[lastPos:i])
+
+			// Convert the character after '\' to an index
+			index, _ := strconv.Atoi(string(format[i+1]))
+
+			// Append the corresponding group if it exists
+			if index < len(matches) {
+				result.WriteString(matches[index])
+			}
+
+			// Skip over the number
+			i++
+			lastPos = i + 1
+		}
+	}
+
+	// Append the remaining part of the format string
+	if lastPos < len(format) {
+		result.WriteString(format[lastPos:])
+	}
+
+	return result.String()
+}
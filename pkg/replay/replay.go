@@ -0,0 +1,185 @@
+// Package replay evaluates recorded evaluation contexts against two policy engines
+// and reports the contexts whose outcome changed.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"reflect"
+	"sort"
+
+	"github.com/raphaelreyna/policyauthor"
+)
+
+const defaultMaxExamples = 3
+
+// Outcome is the result of evaluating a context against an engine.
+type Outcome struct {
+	Value any    `json:"value,omitempty"`
+	Hit   bool   `json:"hit"`
+	Err   string `json:"error,omitempty"`
+}
+
+func (o Outcome) String() string {
+	switch {
+	case o.Err != "":
+		return fmt.Sprintf("<error: %s>", o.Err)
+	case !o.Hit:
+		return "<no match>"
+	}
+
+	if b, err := json.Marshal(o.Value); err == nil {
+		return string(b)
+	}
+	return fmt.Sprintf("%v", o.Value)
+}
+
+// Example is a context of the corpus and the line it was read from.
+type Example struct {
+	Line    int            `json:"line"`
+	Context map[string]any `json:"context"`
+}
+
+// Transition groups the contexts whose outcome changed from From to To.
+type Transition struct {
+	From     Outcome   `json:"from"`
+	To       Outcome   `json:"to"`
+	Count    int       `json:"count"`
+	Examples []Example `json:"examples"`
+}
+
+// Report lists the transitions between the outcomes of two engines, most frequent first.
+type Report struct {
+	Total       int           `json:"total"`
+	Changed     int           `json:"changed"`
+	Transitions []*Transition `json:"transitions"`
+}
+
+// Options configure Diff.
+type Options struct {
+	// MaxExamples is the number of example contexts kept per transition. It defaults to 3.
+	MaxExamples int
+	// Seed seeds the selection of weighted values that are not sticky, identically in both engines.
+	Seed uint64
+}
+
+// Diff evaluates every context of corpus, a stream of JSON objects with one object per line,
+// against the old and new engines, which must be distinct.
+// The state of conditions keeping state across evaluations, such as rate limits, is reset in both engines first,
+// and both are given a source of randomness seeded with opts.Seed,
+// so that both start from the same state and replaying a corpus twice reports the same changes.
+func Diff(old, new *policyauthor.PolicyEngine, corpus io.Reader, opts Options) (*Report, error) {
+	if opts.MaxExamples <= 0 {
+		opts.MaxExamples = defaultMaxExamples
+	}
+	for _, pe := range []*policyauthor.PolicyEngine{old, new} {
+		pe.ResetState()
+		pe.SetRand(policyauthor.RandFunc(rand.New(rand.NewPCG(opts.Seed, 0)).Float64))
+	}
+
+	var (
+		report      = &Report{Transitions: []*Transition{}}
+		transitions = map[string]*Transition{}
+	)
+
+	err := ReadCorpus(corpus, func(line int, ctx map[string]any) error {
+		report.Total++
+
+		from, to := evaluate(old, ctx), evaluate(new, ctx)
+		if reflect.DeepEqual(from, to) {
+			return nil
+		}
+		report.Changed++
+
+		key := fmt.Sprintf("%#v\x00%#v", from, to)
+		t, ok := transitions[key]
+		if !ok {
+			t = &Transition{From: from, To: to}
+			transitions[key] = t
+			report.Transitions = append(report.Transitions, t)
+		}
+		t.Count++
+		if len(t.Examples) < opts.MaxExamples {
+			t.Examples = append(t.Examples, Example{Line: line, Context: ctx})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Transitions are first seen in corpus order, keep it between transitions of equal counts.
+	sort.SliceStable(report.Transitions, func(i, j int) bool {
+		return report.Transitions[i].Count > report.Transitions[j].Count
+	})
+
+	return report, nil
+}
+
+// ReadCorpus calls fn with every context of corpus, a stream of JSON objects with one object per line,
+// and the line it was read from. Blank lines are skipped. Reading stops at the first error returned by fn.
+// Numbers are decoded as json.Number, so that large integers are not rounded.
+func ReadCorpus(corpus io.Reader, fn func(line int, ctx map[string]any) error) error {
+	scanner := bufio.NewScanner(corpus)
+	scanner.Buffer(nil, 16<<20)
+
+	for line := 1; scanner.Scan(); line++ {
+		b := bytes.TrimSpace(scanner.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+
+		var ctx map[string]any
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		if err := dec.Decode(&ctx); err != nil {
+			return fmt.Errorf("corpus line %d: %w", line, err)
+		}
+		if dec.More() {
+			return fmt.Errorf("corpus line %d: unexpected data after object", line)
+		}
+		if err := fn(line, ctx); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("could not read corpus: %w", err)
+	}
+
+	return nil
+}
+
+func evaluate(pe *policyauthor.PolicyEngine, ctx map[string]any) Outcome {
+	value, hit, err := pe.Evaluate(ctx)
+	if err != nil {
+		return Outcome{Err: err.Error()}
+	}
+	return Outcome{Value: value, Hit: hit}
+}
+
+// WriteText writes a human readable rendering of r to w.
+func (r *Report) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "%d contexts replayed, %d changed outcome.\n", r.Total, r.Changed)
+	for _, t := range r.Transitions {
+		noun := "contexts"
+		if t.Count == 1 {
+			noun = "context"
+		}
+		fmt.Fprintf(bw, "\n%s -> %s (%d %s)\n", t.From, t.To, t.Count, noun)
+		for _, e := range t.Examples {
+			b, err := json.Marshal(e.Context)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(bw, "  line %d: %s\n", e.Line, b)
+		}
+	}
+
+	return bw.Flush()
+}
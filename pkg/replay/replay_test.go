@@ -0,0 +1,151 @@
+package replay_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/raphaelreyna/policyauthor"
+	"github.com/raphaelreyna/policyauthor/pkg/conditions"
+	"github.com/raphaelreyna/policyauthor/pkg/replay"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func load(t *testing.T, conf string) *policyauthor.PolicyEngine {
+	policyauthor.RegisterConditions(conditions.AllConditionsMap())
+
+	pe := &policyauthor.PolicyEngine{}
+	require.NoError(t, yaml.Unmarshal([]byte(conf), pe))
+	return pe
+}
+
+func TestDiff(t *testing.T) {
+	old := load(t, `
+- value: "https://internal.example.com"
+  conditions:
+  - type: cidr
+    spec:
+      key: "remote_addr"
+      value: "10.0.0.0/8"
+`)
+	new := load(t, `
+- value: "https://beta.example.com"
+  conditions:
+  - type: glob
+    spec:
+      key: "path"
+      pattern: "/beta/**"
+- value: "https://internal.example.com"
+  conditions:
+  - type: cidr
+    spec:
+      key: "remote_addr"
+      value: "10.0.0.0/8"
+`)
+
+	corpus := strings.Join([]string{
+		`{"remote_addr": "10.0.0.1", "path": "/beta/a"}`,
+		`{"remote_addr": "10.0.0.2", "path": "/home"}`,
+		``,
+		`{"remote_addr": "192.168.0.1", "path": "/beta/b"}`,
+		`{"remote_addr": "192.168.0.2", "path": "/beta/c"}`,
+		`{"remote_addr": "10.0.0.3", "path": "/beta/d"}`,
+		`{"path": "/beta/e"}`,
+	}, "\n")
+
+	report, err := replay.Diff(old, new, strings.NewReader(corpus), replay.Options{MaxExamples: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 6, report.Total)
+	assert.Equal(t, 5, report.Changed)
+	require.Len(t, report.Transitions, 3)
+
+	first := report.Transitions[0]
+	assert.Equal(t, `"https://internal.example.com"`, first.From.String())
+	assert.Equal(t, `"https://beta.example.com"`, first.To.String())
+	assert.Equal(t, 2, first.Count)
+	require.Len(t, first.Examples, 1)
+	assert.Equal(t, 1, first.Examples[0].Line)
+
+	second := report.Transitions[1]
+	assert.Equal(t, "<no match>", second.From.String())
+	assert.Equal(t, 2, second.Count)
+	assert.Equal(t, 4, second.Examples[0].Line)
+
+	third := report.Transitions[2]
+	assert.Contains(t, third.From.String(), "<error: key not found: remote_addr")
+	assert.Equal(t, 1, third.Count)
+
+	var buf bytes.Buffer
+	require.NoError(t, report.WriteText(&buf))
+	assert.Contains(t, buf.String(), "6 contexts replayed, 5 changed outcome.\n")
+	assert.Contains(t, buf.String(), "\"https://internal.example.com\" -> \"https://beta.example.com\" (2 contexts)\n  line 1: ")
+
+	_, err = replay.Diff(old, new, strings.NewReader("{}\nnot json"), replay.Options{})
+	assert.ErrorContains(t, err, "corpus line 2")
+}
+
+func TestDiffState(t *testing.T) {
+	conf := `
+- value: throttled
+  conditions:
+  - type: ratelimit
+    spec:
+      key: "remote_addr"
+      limit: 1
+      window: "1h"
+- value: backend
+  conditions:
+  - type: exists
+    spec:
+      key: "remote_addr"
+`
+	old, new := load(t, conf), load(t, conf)
+	// State left over from other evaluations does not leak into the replay.
+	_, _, err := old.Evaluate(map[string]any{"remote_addr": "10.0.0.1"})
+	require.NoError(t, err)
+
+	corpus := strings.Repeat(`{"remote_addr": "10.0.0.1"}`+"\n", 4)
+
+	for i := 0; i < 2; i++ {
+		report, err := replay.Diff(old, new, strings.NewReader(corpus), replay.Options{})
+		require.NoError(t, err)
+		assert.Equal(t, 4, report.Total)
+		assert.Equal(t, 0, report.Changed)
+	}
+}
+
+func TestDiffRand(t *testing.T) {
+	conf := `
+- values:
+  - value: a
+    weight: 1
+  - value: b
+    weight: 1
+  conditions:
+  - type: exists
+    spec:
+      key: "id"
+`
+	corpus := strings.Repeat(`{"id": 1}`+"\n", 20)
+
+	report, err := replay.Diff(load(t, conf), load(t, conf), strings.NewReader(corpus), replay.Options{Seed: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 20, report.Total)
+	assert.Equal(t, 0, report.Changed)
+}
+
+func TestReadCorpus(t *testing.T) {
+	var got []map[string]any
+	err := replay.ReadCorpus(strings.NewReader(`{"id": 9007199254740993, "ratio": 0.5}`), func(line int, ctx map[string]any) error {
+		got = append(got, ctx)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]any{{"id": json.Number("9007199254740993"), "ratio": json.Number("0.5")}}, got)
+
+	err = replay.ReadCorpus(strings.NewReader(`{} {}`), func(line int, ctx map[string]any) error { return nil })
+	assert.ErrorContains(t, err, "corpus line 1: unexpected data after object")
+}
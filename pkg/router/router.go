@@ -0,0 +1,321 @@
+package router
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/raphaelreyna/policyauthor"
+	"github.com/raphaelreyna/policyauthor/pkg/httpctx"
+	"github.com/raphaelreyna/policyauthor/pkg/maputils"
+	"github.com/raphaelreyna/policyauthor/pkg/regexutils"
+	"gopkg.in/yaml.v3"
+)
+
+// Config configures a Router.
+//
+//	fallback: "https://default.internal"
+//	headers:
+//	  - header: "X-Tenant"
+//	    key: "host"
+//	    pattern: "(.*)\\.example\\.com"
+//	    value: "\\1"
+//	upstreams:
+//	  "https://canary.internal":
+//	    responseHeaderTimeout: "5s"
+//	policies:
+//	  - value: "https://canary.internal"
+//	    conditions: ...
+type Config struct {
+	// Policies select the upstream URL for each request.
+	Policies *policyauthor.PolicyEngine `yaml:"policies"`
+	// Fallback is the upstream for requests no policy matches or that fail to evaluate.
+	Fallback string `yaml:"fallback"`
+	// Headers rewrite the headers of every proxied request, before those of the upstream.
+	Headers []*HeaderRewrite `yaml:"headers"`
+	// Upstreams holds the upstreams requests may be proxied to besides the fallback, with their settings, by URL.
+	// Requests routed to any other upstream are answered with 502 Bad Gateway.
+	Upstreams map[string]*Upstream `yaml:"upstreams"`
+}
+
+// Upstream holds the transport settings and header rewrites of an upstream.
+type Upstream struct {
+	DialTimeout           string `yaml:"dialTimeout"`
+	ResponseHeaderTimeout string `yaml:"responseHeaderTimeout"`
+	IdleConnTimeout       string `yaml:"idleConnTimeout"`
+	MaxIdleConnsPerHost   int    `yaml:"maxIdleConnsPerHost"`
+	InsecureSkipVerify    bool   `yaml:"insecureSkipVerify"`
+	TLSServerName         string `yaml:"tlsServerName"`
+
+	Headers []*HeaderRewrite `yaml:"headers"`
+}
+
+// HeaderRewrite sets or removes a request header.
+//
+// Without Pattern, Header is set to Value. With Pattern, Header is set to Value only when the string
+// at Key in the evaluation context matches Pattern, and \1, \2, etc. in Value are replaced by the captured groups.
+// An empty Value removes the header.
+type HeaderRewrite struct {
+	Header  string `yaml:"header"`
+	Key     string `yaml:"key"`
+	Pattern string `yaml:"pattern"`
+	Value   string `yaml:"value"`
+
+	r *regexp.Regexp `yaml:"-"`
+}
+
+func (h *HeaderRewrite) UnmarshalYAML(value *yaml.Node) error {
+	type T HeaderRewrite
+	var t T
+	if err := value.Decode(&t); err != nil {
+		return err
+	}
+	*h = HeaderRewrite(t)
+
+	return h.compile()
+}
+
+func (h *HeaderRewrite) compile() error {
+	if h.Header == "" {
+		return fmt.Errorf("header rewrite must set header")
+	}
+	if h.Pattern == "" {
+		return nil
+	}
+	if h.Key == "" {
+		return fmt.Errorf("header rewrite of %s has a pattern but no key", h.Header)
+	}
+
+	var err error
+	if h.r, err = regexp.Compile(h.Pattern); err != nil {
+		return fmt.Errorf("header rewrite of %s: %s", h.Header, err)
+	}
+	return nil
+}
+
+func (h *HeaderRewrite) apply(header http.Header, evaluationContext map[string]any) {
+	value := h.Value
+	if h.r != nil {
+		val, _ := maputils.RecursiveGet(h.Key, evaluationContext)
+		str, ok := val.(string)
+		if !ok || !h.r.MatchString(str) {
+			return
+		}
+		value = regexutils.Format(h.r, str, h.Value)
+	}
+
+	if value == "" {
+		header.Del(h.Header)
+	} else {
+		header.Set(h.Header, value)
+	}
+}
+
+// Router is an http.Handler proxying each request to the upstream URL returned by a PolicyEngine.
+type Router struct {
+	engine    *policyauthor.PolicyEngine
+	fallback  string
+	headers   []*HeaderRewrite
+	upstreams map[string]*Upstream
+
+	// ContextFunc builds evaluation contexts from requests, httpctx.FromRequest by default.
+	ContextFunc func(r *http.Request) map[string]any
+	// ErrorLog logs evaluation and proxy errors, the standard logger by default.
+	ErrorLog *log.Logger
+
+	// proxies holds the proxies of the configured upstreams and of the fallback. It is not modified after New.
+	proxies map[string]*upstreamProxy
+}
+
+type upstreamProxy struct {
+	target  *url.URL
+	proxy   *httputil.ReverseProxy
+	headers []*HeaderRewrite
+}
+
+// New returns a Router for cfg.
+func New(cfg *Config) (*Router, error) {
+	if cfg.Policies == nil {
+		return nil, fmt.Errorf("router: policies must be set")
+	}
+
+	rt := &Router{
+		engine:    cfg.Policies,
+		fallback:  cfg.Fallback,
+		headers:   cfg.Headers,
+		upstreams: map[string]*Upstream{},
+		proxies:   map[string]*upstreamProxy{},
+	}
+
+	for _, h := range rt.headers {
+		if err := h.compile(); err != nil {
+			return nil, fmt.Errorf("router: %s", err)
+		}
+	}
+
+	// Build the configured upstreams up front to surface configuration errors.
+	for target, u := range cfg.Upstreams {
+		if u == nil {
+			u = &Upstream{}
+		}
+		rt.upstreams[target] = u
+		for _, h := range u.Headers {
+			if err := h.compile(); err != nil {
+				return nil, fmt.Errorf("router: upstream %s: %s", target, err)
+			}
+		}
+		if err := rt.addProxy(target); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := rt.proxies[rt.fallback]; !ok && rt.fallback != "" {
+		if err := rt.addProxy(rt.fallback); err != nil {
+			return nil, err
+		}
+	}
+
+	return rt, nil
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	contextFunc := rt.ContextFunc
+	if contextFunc == nil {
+		contextFunc = httpctx.FromRequest
+	}
+	evaluationContext := contextFunc(r)
+
+	target := rt.fallback
+	d := httpctx.Evaluate(rt.engine, evaluationContext)
+	switch {
+	case d.Err != nil:
+		rt.logf("router: policy evaluation failed for %s %s: %s", r.Method, r.URL, d.Err)
+	case d.Hit:
+		switch v := d.Value.(type) {
+		case string:
+			target = v
+		case *url.URL:
+			target = v.String()
+		default:
+			rt.logf("router: policy returned %T, expected an upstream URL", d.Value)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if target == "" {
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+
+	up, ok := rt.proxies[target]
+	if !ok {
+		rt.logf("router: upstream %q is not configured", target)
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+
+	r = r.WithContext(httpctx.NewContext(r.Context(), d))
+	up.proxy.ServeHTTP(w, r)
+}
+
+func (rt *Router) addProxy(target string) error {
+	up, err := rt.newProxy(target)
+	if err != nil {
+		return err
+	}
+	rt.proxies[target] = up
+	return nil
+}
+
+func (rt *Router) newProxy(target string) (*upstreamProxy, error) {
+	u, err := url.Parse(target)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("router: invalid upstream URL %q", target)
+	}
+
+	up := &upstreamProxy{target: u}
+	transport := http.DefaultTransport
+	if cfg, ok := rt.upstreams[target]; ok {
+		if transport, err = cfg.transport(); err != nil {
+			return nil, fmt.Errorf("router: upstream %s: %s", target, err)
+		}
+		up.headers = cfg.Headers
+	}
+
+	up.proxy = &httputil.ReverseProxy{
+		Transport: transport,
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(up.target)
+			pr.SetXForwarded()
+
+			var evaluationContext map[string]any
+			if d, ok := httpctx.DecisionFromContext(pr.In.Context()); ok {
+				evaluationContext = d.Context
+			}
+			for _, h := range rt.headers {
+				h.apply(pr.Out.Header, evaluationContext)
+			}
+			for _, h := range up.headers {
+				h.apply(pr.Out.Header, evaluationContext)
+			}
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			rt.logf("router: proxying %s %s to %s: %s", r.Method, r.URL, target, err)
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+
+	return up, nil
+}
+
+func (rt *Router) logf(format string, args ...any) {
+	if rt.ErrorLog != nil {
+		rt.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+func (u *Upstream) transport() (http.RoundTripper, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+
+	durations := []struct {
+		name  string
+		value string
+		set   func(d time.Duration)
+	}{
+		{"dialTimeout", u.DialTimeout, func(d time.Duration) {
+			t.DialContext = (&net.Dialer{Timeout: d, KeepAlive: 30 * time.Second}).DialContext
+		}},
+		{"responseHeaderTimeout", u.ResponseHeaderTimeout, func(d time.Duration) { t.ResponseHeaderTimeout = d }},
+		{"idleConnTimeout", u.IdleConnTimeout, func(d time.Duration) { t.IdleConnTimeout = d }},
+	}
+	for _, x := range durations {
+		if x.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(x.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", x.name, err)
+		}
+		x.set(d)
+	}
+
+	if u.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = u.MaxIdleConnsPerHost
+	}
+	if u.InsecureSkipVerify || u.TLSServerName != "" {
+		t.TLSClientConfig = &tls.Config{
+			InsecureSkipVerify: u.InsecureSkipVerify,
+			ServerName:         u.TLSServerName,
+		}
+	}
+
+	return t, nil
+}
@@ -0,0 +1,93 @@
+package router_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/raphaelreyna/policyauthor"
+	"github.com/raphaelreyna/policyauthor/pkg/conditions"
+	"github.com/raphaelreyna/policyauthor/pkg/router"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func upstream(name string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, name+" "+r.Header.Get("X-Tenant"))
+	}))
+}
+
+func TestRouter(t *testing.T) {
+	policyauthor.RegisterConditions(conditions.AllConditionsMap())
+
+	stable, canary := upstream("stable"), upstream("canary")
+	defer stable.Close()
+	defer canary.Close()
+
+	conf := `
+fallback: "` + stable.URL + `"
+headers:
+  - header: "X-Tenant"
+    key: "hostname"
+    pattern: "(.*)\\.example\\.com"
+    value: "\\1"
+upstreams:
+  "` + canary.URL + `":
+    responseHeaderTimeout: "5s"
+policies:
+  - conditions:
+      - type: and
+        spec:
+          conditions:
+            - type: exists
+              spec:
+                key: "headers.X-Upstream"
+            - type: regex
+              spec:
+                key: "headers.X-Upstream"
+                pattern: "^(http://.*)$"
+                return: \1
+  - value: "` + canary.URL + `"
+    conditions:
+      - type: equal
+        spec:
+          key: "headers.X-Canary"
+          value: "1"
+`
+
+	cfg := router.Config{Policies: &policyauthor.PolicyEngine{}}
+	require.NoError(t, yaml.Unmarshal([]byte(conf), &cfg))
+
+	rt, err := router.New(&cfg)
+	require.NoError(t, err)
+
+	serve := func(canary bool) string {
+		r := httptest.NewRequest(http.MethodGet, "http://acme.example.com/", nil)
+		if canary {
+			r.Header.Set("X-Canary", "1")
+		}
+		w := httptest.NewRecorder()
+		rt.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+		return w.Body.String()
+	}
+
+	assert.Equal(t, "canary acme", serve(true))
+	assert.Equal(t, "stable acme", serve(false))
+
+	// Upstreams derived from requests are not proxied to unless configured.
+	var reached bool
+	dynamic := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+	defer dynamic.Close()
+	r := httptest.NewRequest(http.MethodGet, "http://acme.example.com/", nil)
+	r.Header.Set("X-Upstream", dynamic.URL)
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.False(t, reached)
+}
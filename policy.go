@@ -2,13 +2,16 @@ package policyauthor
 
 import (
 	"fmt"
+	"slices"
+	"strconv"
 	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
 var (
-	ErrKeyNotFound = fmt.Errorf("key not found")
+	ErrKeyNotFound  = fmt.Errorf("key not found")
+	ErrEmptyContext = fmt.Errorf("evaluation context is empty")
 )
 
 func NewKeyNotFoundError(key string) error {
@@ -16,9 +19,22 @@ func NewKeyNotFoundError(key string) error {
 }
 
 type Policy struct {
-	Value      any          `yaml:"value"`
-	ValueFrom  string       `yaml:"valueFrom"`
-	Conditions []*Condition `yaml:"conditions"`
+	// Name identifies the policy in metrics and logs, policies without a name are identified by their index.
+	Name      string `yaml:"name"`
+	Value     any    `yaml:"value"`
+	ValueFrom string `yaml:"valueFrom"`
+	// Values selects one of several candidate values by weight.
+	// The selection is sticky when StickyBy lists context keys, hashed together with Salt, and random otherwise.
+	Values     []*WeightedValue `yaml:"values"`
+	StickyBy   []string         `yaml:"stickyBy"`
+	Salt       string           `yaml:"salt"`
+	Conditions []*Condition     `yaml:"conditions"`
+
+	rand RandSource `yaml:"-"`
+	// line locates the policy in the YAML it was unmarshaled from.
+	line int `yaml:"-"`
+	// coverage records the outcomes of the policy while coverage is enabled.
+	coverage *coverageCounter `yaml:"-"`
 }
 
 func (p *Policy) UnmarshalYAML(value *yaml.Node) error {
@@ -29,51 +45,82 @@ func (p *Policy) UnmarshalYAML(value *yaml.Node) error {
 		return err
 	}
 	*p = Policy(t)
+	p.line = value.Line
 
 	if p.ValueFrom != "" && p.Value != nil {
 		return fmt.Errorf("cannot have both value and valueFrom")
 	}
 
+	if len(p.Values) > 0 {
+		if p.ValueFrom != "" || p.Value != nil {
+			return fmt.Errorf("cannot have values with value or valueFrom")
+		}
+		if err := validateWeights(p.Values); err != nil {
+			return err
+		}
+	} else if len(p.StickyBy) > 0 {
+		return fmt.Errorf("stickyBy requires values")
+	}
+
 	return nil
 }
 
-func (p *Policy) Evaluate(evaluationContext map[string]any) (value any, hit bool, err error) {
-	if len(evaluationContext) == 0 {
-		return nil, false, fmt.Errorf("evaluation context is empty")
+// value returns the value of the policy for a hit against evaluationContext.
+func (p *Policy) value(evaluationContext map[string]any) (any, error) {
+	switch {
+	case p.ValueFrom != "":
+		return evaluationContext[p.ValueFrom], nil
+	case len(p.Values) > 0:
+		if len(p.StickyBy) > 0 {
+			f, err := stickyFraction(p.StickyBy, p.Salt, evaluationContext)
+			if err != nil {
+				return nil, err
+			}
+			return pickWeighted(p.Values, f), nil
+		}
+
+		r := p.rand
+		if r == nil {
+			r = SystemRand
+		}
+		return pickWeighted(p.Values, r.Float64()), nil
+	default:
+		return p.Value, nil
 	}
+}
 
-	val := p.Value
-	if p.ValueFrom != "" {
-		val = evaluationContext[p.ValueFrom]
+func (p *Policy) Evaluate(evaluationContext map[string]any) (value any, hit bool, err error) {
+	if len(evaluationContext) == 0 {
+		return nil, false, ErrEmptyContext
 	}
 
 	for _, c := range p.Conditions {
 		if vr, ok := c.Spec.(ValueReturner); ok {
 			if !vr.ValueReturnEnabled() {
-				if hit, err = c.Spec.Evaluate(evaluationContext); err != nil {
+				if hit, err = c.Evaluate(evaluationContext); err != nil {
 					return
 				}
 				if hit {
-					return val, true, nil
+					return p.hit(evaluationContext)
 				}
 			} else {
-				value, hit, err = vr.EvaluateWithReturnValue(evaluationContext)
+				value, hit, err = c.EvaluateWithReturnValue(evaluationContext)
 				if err != nil {
 					return
 				}
 				if hit {
 					if _, ok := value.(ValueReturnerNil); ok {
-						return val, true, nil
+						return p.hit(evaluationContext)
 					}
 					return value, true, nil
 				}
 			}
 		} else {
-			if hit, err = c.Spec.Evaluate(evaluationContext); err != nil {
+			if hit, err = c.Evaluate(evaluationContext); err != nil {
 				return
 			}
 			if hit {
-				return val, true, nil
+				return p.hit(evaluationContext)
 			}
 		}
 	}
@@ -81,6 +128,51 @@ func (p *Policy) Evaluate(evaluationContext map[string]any) (value any, hit bool
 	return nil, false, nil
 }
 
+func (p *Policy) hit(evaluationContext map[string]any) (any, bool, error) {
+	val, err := p.value(evaluationContext)
+	if err != nil {
+		return nil, false, err
+	}
+	return val, true, nil
+}
+
+// contextKeys returns the keys of the evaluation context the policy reads.
+// It returns false if some of its conditions do not report the keys they read.
+func (p *Policy) contextKeys() ([]string, bool) {
+	keys := slices.Clone(p.StickyBy)
+	if p.ValueFrom != "" {
+		keys = append(keys, p.ValueFrom)
+	}
+
+	ok := true
+	for _, c := range p.Conditions {
+		Walk(c, func(c *Condition) bool {
+			if kr, isKeyReader := c.Spec.(KeyReader); isKeyReader {
+				keys = append(keys, kr.ContextKeys()...)
+			} else if _, isParent := c.Spec.(ConditionParent); !isParent {
+				// The keys of a leaf that does not report them are unknown.
+				ok = false
+			}
+			return true
+		})
+	}
+
+	return keys, ok
+}
+
+// Line returns the line of the policy in the YAML it was unmarshaled from.
+func (p *Policy) Line() int {
+	return p.line
+}
+
+// label identifies the policy at index i of its engine.
+func (p *Policy) label(i int) string {
+	if p.Name != "" {
+		return p.Name
+	}
+	return strconv.Itoa(i)
+}
+
 func (p *Policy) String() string {
 	b := strings.Builder{}
 	for i, c := range p.Conditions {
@@ -2,13 +2,35 @@ package policyauthor
 
 import (
 	"fmt"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/raphaelreyna/policyauthor/pkg/hashutils"
+	"github.com/raphaelreyna/policyauthor/pkg/maputils"
 	"gopkg.in/yaml.v3"
 )
 
 type PolicyEngine struct {
-	policies []*Policy `yaml:"-"`
+	policies []*Policy  `yaml:"-"`
+	clock    Clock      `yaml:"-"`
+	rand     RandSource `yaml:"-"`
+
+	cacheSize int            `yaml:"-"`
+	cacheTTL  time.Duration  `yaml:"-"`
+	cache     *decisionCache `yaml:"-"`
+	metrics   Metrics        `yaml:"-"`
+
+	decisionLogger DecisionLogger `yaml:"-"`
+	version        string         `yaml:"-"`
+	// configVersion identifies the configuration the engine was unmarshaled from.
+	configVersion string `yaml:"-"`
+	// coverage is set while coverage is enabled.
+	coverage bool `yaml:"-"`
+	// readKeys[i] are the sorted keys read by the policies up to and including the policy at index i.
+	readKeys [][]string `yaml:"-"`
+	// state holds the state of the Stateful conditions, by type and StateKey.
+	state map[string]any `yaml:"-"`
 }
 
 func (pe *PolicyEngine) UnmarshalYAML(value *yaml.Node) error {
@@ -40,24 +62,281 @@ func (pe *PolicyEngine) UnmarshalYAML(value *yaml.Node) error {
 		return fmt.Errorf("no policies found")
 	}
 
+	if b, err := yaml.Marshal(value); err == nil {
+		pe.configVersion = fmt.Sprintf("%016x", hashutils.Hash("", string(b)))
+	}
+
+	pe.readKeys = make([][]string, len(pe.policies))
+	var keys []string
+	for i, p := range pe.policies {
+		pk, _ := p.contextKeys()
+		keys = append(keys, pk...)
+		slices.Sort(keys)
+		keys = slices.Compact(keys)
+		pe.readKeys[i] = slices.Clip(keys)
+	}
+
+	pe.attachState(nil)
+
+	if pe.clock != nil {
+		pe.SetClock(pe.clock)
+	}
+	if pe.rand != nil {
+		pe.SetRand(pe.rand)
+	}
+	if pe.cacheSize > 0 {
+		pe.EnableCache(pe.cacheSize, pe.cacheTTL)
+	}
+	if pe.coverage {
+		pe.EnableCoverage()
+	}
+
 	return nil
 }
 
+// Policies returns the policies of the engine, in evaluation order.
+func (pe *PolicyEngine) Policies() []*Policy {
+	return pe.policies
+}
+
+// SetVersion sets the version reported in decision logs.
+// By default the version is derived from the configuration the engine was unmarshaled from.
+func (pe *PolicyEngine) SetVersion(v string) {
+	pe.version = v
+}
+
+// Version returns the version reported in decision logs.
+func (pe *PolicyEngine) Version() string {
+	if pe.version != "" {
+		return pe.version
+	}
+	return pe.configVersion
+}
+
+// SetDecisionLogger sets the logger every decision is reported to. A nil value disables logging.
+func (pe *PolicyEngine) SetDecisionLogger(l DecisionLogger) {
+	pe.decisionLogger = l
+}
+
+// SetMetrics sets the metrics every evaluation is reported to. A nil value disables reporting.
+func (pe *PolicyEngine) SetMetrics(m Metrics) {
+	pe.metrics = m
+}
+
+// EnableCache caches up to size decisions for ttl, a ttl of zero keeps decisions until they are evicted.
+// Any previously cached decisions are dropped.
+//
+// Decisions are cached for the longest run of leading policies whose outcome only depends on the keys
+// of the evaluation context they read, and are looked up by a fingerprint of the values at those keys.
+// Evaluation falls through to the remaining policies when none of the cached ones hit.
+// Policies using volatile conditions, conditions that do not report the keys they read,
+// or weighted values that are not sticky end the run. Errors are never cached.
+func (pe *PolicyEngine) EnableCache(size int, ttl time.Duration) {
+	if size <= 0 {
+		pe.DisableCache()
+		return
+	}
+
+	pe.cacheSize = size
+	pe.cacheTTL = ttl
+	pe.cache = newDecisionCache(size, ttl, pe.policies)
+}
+
+// DisableCache disables decision caching.
+func (pe *PolicyEngine) DisableCache() {
+	pe.cacheSize = 0
+	pe.cacheTTL = 0
+	pe.cache = nil
+}
+
+// CacheStats returns the activity of the decision cache, or false if caching is disabled.
+func (pe *PolicyEngine) CacheStats() (CacheStats, bool) {
+	if pe.cache == nil {
+		return CacheStats{}, false
+	}
+	return pe.cache.stats(), true
+}
+
+// SetClock sets the clock used by every time dependent condition in the engine.
+// A nil clock restores the system clock.
+func (pe *PolicyEngine) SetClock(c Clock) {
+	if c == nil {
+		c = SystemClock
+	}
+	pe.clock = c
+
+	pe.walk(func(c *Condition) bool {
+		if cu, ok := c.Spec.(ClockUser); ok {
+			cu.SetClock(pe.clock)
+		}
+		return true
+	})
+}
+
+// Clock returns the clock used by the engine.
+func (pe *PolicyEngine) Clock() Clock {
+	if pe.clock == nil {
+		return SystemClock
+	}
+	return pe.clock
+}
+
+// SetRand sets the source of randomness used to select weighted values that are not sticky.
+// A nil source restores SystemRand.
+func (pe *PolicyEngine) SetRand(r RandSource) {
+	if r == nil {
+		r = SystemRand
+	}
+	pe.rand = r
+
+	for _, p := range pe.policies {
+		p.rand = r
+	}
+}
+
+func (pe *PolicyEngine) walk(fn func(c *Condition) bool) {
+	for _, p := range pe.policies {
+		for _, c := range p.Conditions {
+			Walk(c, fn)
+		}
+	}
+}
+
 func (pe *PolicyEngine) Evaluate(evaluationContext map[string]any) (value any, hit bool, err error) {
+	d, err := pe.evaluateObserved(evaluationContext)
+	return d.value, d.hit, err
+}
+
+// evaluateObserved evaluates the policies, reporting the decision to the metrics and decision logger.
+func (pe *PolicyEngine) evaluateObserved(evaluationContext map[string]any) (decision, error) {
+	if pe.metrics == nil && pe.decisionLogger == nil {
+		return pe.evaluate(evaluationContext)
+	}
+
+	start := time.Now()
+	d, err := pe.evaluate(evaluationContext)
+	duration := time.Since(start)
+
+	var label string
+	if d.hit {
+		label = pe.policies[d.policy].label(d.policy)
+	}
+
+	if pe.metrics != nil {
+		pe.metrics.ObserveEvaluation(Observation{Policy: label, Hit: d.hit, Err: err, Duration: duration})
+	}
+	if pe.decisionLogger != nil {
+		pe.decisionLogger.LogDecision(&DecisionRecord{
+			Time:          pe.Clock().Now(),
+			EngineVersion: pe.Version(),
+			Policy:        label,
+			PolicyIndex:   d.policy,
+			Hit:           d.hit,
+			Value:         d.value,
+			Err:           err,
+			Context:       pe.dependencies(d, err, evaluationContext),
+			Duration:      duration,
+		})
+	}
+
+	return d, err
+}
+
+// dependencies returns the values of the keys of evaluationContext read to reach d.
+func (pe *PolicyEngine) dependencies(d decision, err error, evaluationContext map[string]any) map[string]any {
+	if len(pe.readKeys) == 0 || len(evaluationContext) == 0 {
+		return nil
+	}
+
+	keys := pe.readKeys[len(pe.readKeys)-1]
+	if d.hit || (err != nil && d.policy >= 0) {
+		keys = pe.readKeys[d.policy]
+	}
+
+	deps := make(map[string]any, len(keys))
+	for _, k := range keys {
+		if k == "" {
+			deps[k] = evaluationContext
+			continue
+		}
+		if val, found := maputils.RecursiveGet(k, evaluationContext); found {
+			deps[k] = val
+		}
+	}
+
+	return deps
+}
+
+// decision is the outcome of evaluating the policies of an engine.
+type decision struct {
+	value any
+	hit   bool
+	// policy is the index of the policy that hit, or that failed when evaluation failed.
+	// It is -1 on misses and when evaluation failed before any policy was evaluated.
+	policy int
+}
+
+func (pe *PolicyEngine) evaluate(evaluationContext map[string]any) (decision, error) {
 	if len(evaluationContext) == 0 {
-		return nil, false, fmt.Errorf("evaluation context is empty")
+		return decision{policy: -1}, ErrEmptyContext
 	}
 
-	for _, p := range pe.policies {
-		if value, hit, err = p.Evaluate(evaluationContext); err != nil {
-			return
+	offset := 0
+	// Cached decisions would hide the outcomes of conditions from coverage.
+	if c := pe.cache; c != nil && c.prefix > 0 && !pe.coverage {
+		if d, err := pe.evaluateCached(c, evaluationContext); err != nil || d.hit {
+			return d, err
+		}
+		offset = c.prefix
+	}
+
+	return evaluatePolicies(pe.policies, offset, evaluationContext)
+}
+
+// evaluateCached evaluates the policies covered by c, using and filling the cache.
+func (pe *PolicyEngine) evaluateCached(c *decisionCache, evaluationContext map[string]any) (decision, error) {
+	policies := pe.policies[:c.prefix]
+
+	fp, ok := c.fingerprint(evaluationContext)
+	if !ok {
+		return evaluatePolicies(policies, 0, evaluationContext)
+	}
+
+	now := pe.Clock().Now()
+	if e, ok := c.get(fp, now); ok {
+		d := e.decision
+		d.value = copyValue(d.value)
+		return d, nil
+	}
+
+	d, err := evaluatePolicies(policies, 0, evaluationContext)
+	if err != nil {
+		return d, err
+	}
+	cached := d
+	cached.value = copyValue(d.value)
+	c.put(fp, cached, now)
+
+	return d, nil
+}
+
+// evaluatePolicies evaluates policies in order starting at offset, returning the decision of the first hit.
+func evaluatePolicies(policies []*Policy, offset int, evaluationContext map[string]any) (decision, error) {
+	for i := offset; i < len(policies); i++ {
+		p := policies[i]
+		value, hit, err := p.Evaluate(evaluationContext)
+		if p.coverage != nil {
+			p.coverage.record(hit, err)
+		}
+		if err != nil {
+			return decision{policy: i}, err
 		}
 		if hit {
-			return
+			return decision{value: value, hit: true, policy: i}, nil
 		}
 	}
 
-	return nil, false, nil
+	return decision{policy: -1}, nil
 }
 
 func (pe *PolicyEngine) String() string {
@@ -1,7 +1,15 @@
 package policyauthor_test
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/raphaelreyna/policyauthor"
 	"github.com/raphaelreyna/policyauthor/pkg/conditions"
@@ -198,85 +206,1751 @@ policies:
 				},
 			},
 		},
-	}
-
-	for name, test := range tests {
-		t.Run(name, func(t *testing.T) {
-			p := struct {
-				Policies *policyauthor.PolicyEngine `yaml:"policies"`
-			}{
-				Policies: &policyauthor.PolicyEngine{},
-			}
-
-			err := yaml.Unmarshal([]byte(test.Config), &p)
-			require.NoError(t, err)
-
-			for ctxIdx, ctxTest := range test.ContextTests {
-				value, hit, err := p.Policies.Evaluate(ctxTest.Map)
-				ctxTest.TestFunc(t, ctxIdx, value, hit, err)
-			}
-		})
-	}
-}
-
-func TestEdgeCases(t *testing.T) {
-	policyauthor.RegisterConditions(conditions.AllConditionsMap())
-
-	var edgeCaseTests = map[string]TestConfig{
-		"empty_map": {
+		"range": {
 			Config: `
 policies:
-- value: empty_test
-  conditions:
-  - type: equal
-    spec:
-      key: "nonexistent"
-      value: "none"
+  - value: small
+    conditions:
+      - type: range
+        spec:
+          key: "n"
+          gt: 0
+          upper: 9007199254740993
+          numericStrings: true
 `,
 			ContextTests: []ContextTest{
 				{
-					Map: map[string]any{},
+					Map: map[string]any{"n": uint8(1)},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.True(t, hit)
+					},
+				},
+				{
+					Map: map[string]any{"n": float32(0)},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.False(t, hit)
+					},
+				},
+				{
+					Map: map[string]any{"n": int64(9007199254740993)},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.True(t, hit)
+					},
+				},
+				{
+					Map: map[string]any{"n": json.Number("9007199254740994")},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.False(t, hit)
+					},
+				},
+				{
+					Map: map[string]any{"n": "0.5"},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.True(t, hit)
+					},
+				},
+				{
+					Map: map[string]any{"n": true},
 					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
 						assert.Error(t, err)
 						assert.False(t, hit)
-						assert.Nil(t, value)
 					},
 				},
 			},
 		},
-		"malformed_config": {
+		"in": {
 			Config: `
 policies:
- - value:`,
+  - value: eu
+    conditions:
+      - type: in
+        spec:
+          key: "country"
+          caseInsensitive: true
+          values: ["de", "FR", "es"]
+  - value: internal
+    conditions:
+      - type: notIn
+        spec:
+          key: "port"
+          values: [80, 443]
+`,
 			ContextTests: []ContextTest{
 				{
-					Map:      map[string]any{"remote_addr": "foo"},
-					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {},
+					Map: map[string]any{"country": "Fr", "port": int64(80)},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.Equal(t, "eu", value)
+					},
+				},
+				{
+					Map: map[string]any{"country": "us", "port": float64(443)},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.False(t, hit)
+					},
+				},
+				{
+					Map: map[string]any{"country": "us", "port": json.Number("8080")},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.Equal(t, "internal", value)
+					},
 				},
 			},
 		},
-	}
-
-	for name, test := range edgeCaseTests {
-		t.Run(name, func(t *testing.T) {
-			p := struct {
-				Policies *policyauthor.PolicyEngine `yaml:"policies"`
-			}{
-				Policies: &policyauthor.PolicyEngine{},
-			}
-
-			err := yaml.Unmarshal([]byte(test.Config), &p)
-			if name == "malformed_config" {
-				require.Error(t, err)
-				return
-			} else {
-				require.NoError(t, err)
-			}
-
-			for ctxIdx, ctxTest := range test.ContextTests {
-				value, hit, err := p.Policies.Evaluate(ctxTest.Map)
-				ctxTest.TestFunc(t, ctxIdx, value, hit, err)
-			}
-		})
-	}
+		"string": {
+			Config: `
+policies:
+  - value: bot
+    conditions:
+      - type: string
+        spec:
+          key: "ua"
+          caseInsensitive: true
+          normalize: nfkc
+          values: ["bot", "crawler", "spider", "slurp", "fetcher", "scraper", "archiver", "indexer", "profiler"]
+  - value: api
+    conditions:
+      - type: string
+        spec:
+          key: "path"
+          op: hasPrefix
+          values: ["/api/", "/v1/"]
+  - value: legacy
+    conditions:
+      - type: contains
+        spec:
+          key: "path"
+          value: "legacy"
+`,
+			ContextTests: []ContextTest{
+				{
+					Map: map[string]any{"ua": "Mozilla/5.0 (compatible; Googlebot/2.1)", "path": "/"},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.Equal(t, "bot", value)
+					},
+				},
+				{
+					Map: map[string]any{"ua": "Ｐｒｏｆｉｌｅｒ", "path": "/"},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.Equal(t, "bot", value)
+					},
+				},
+				{
+					Map: map[string]any{"ua": "curl/8.0", "path": "/v1/users"},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.Equal(t, "api", value)
+					},
+				},
+				{
+					Map: map[string]any{"ua": "curl/8.0", "path": "/static/legacy/app.js"},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.Equal(t, "legacy", value)
+					},
+				},
+				{
+					Map: map[string]any{"ua": "curl/8.0", "path": "/home"},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.False(t, hit)
+					},
+				},
+			},
+		},
+		"glob": {
+			Config: `
+policies:
+  - value: tenant
+    conditions:
+      - type: glob
+        spec:
+          key: "host"
+          style: host
+          caseInsensitive: true
+          pattern: "*.example.com"
+          return: "https://\\1.internal"
+  - value: users
+    conditions:
+      - type: glob
+        spec:
+          key: "path"
+          pattern: "/api/*/users/**"
+  - value: escaped
+    conditions:
+      - type: glob
+        spec:
+          key: "host"
+          style: host
+          pattern: "*.a\\.b"
+`,
+			ContextTests: []ContextTest{
+				{
+					Map: map[string]any{"host": "Acme.Example.com", "path": "/"},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.Equal(t, "https://Acme.internal", value)
+					},
+				},
+				{
+					Map: map[string]any{"host": "a.b.example.com", "path": "/api/v1/users"},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.Equal(t, "users", value)
+					},
+				},
+				{
+					Map: map[string]any{"host": "example.com", "path": "/api/v1/users/42/roles"},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.Equal(t, "users", value)
+					},
+				},
+				{
+					Map: map[string]any{"host": "example.com", "path": "/api/v1/v2/users"},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.False(t, hit)
+					},
+				},
+				{
+					Map: map[string]any{"host": "x.a.b", "path": "/"},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.Equal(t, "escaped", value)
+					},
+				},
+			},
+		},
+		"semver": {
+			Config: `
+policies:
+  - value: v2
+    conditions:
+      - type: semver
+        spec:
+          key: "headers.X-Client-Version"
+          constraint: ">= 2.3.0, < 3.0.0 || ~3.1"
+`,
+			ContextTests: []ContextTest{
+				{
+					Map: map[string]any{"headers": map[string]any{"X-Client-Version": "v2.10.1"}},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.True(t, hit)
+					},
+				},
+				{
+					Map: map[string]any{"headers": map[string]any{"X-Client-Version": "3.0.0-rc.1"}},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.True(t, hit)
+					},
+				},
+				{
+					Map: map[string]any{"headers": map[string]any{"X-Client-Version": "2.3.0-beta"}},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.False(t, hit)
+					},
+				},
+				{
+					Map: map[string]any{"headers": map[string]any{"X-Client-Version": "3.1.9+build.7"}},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.True(t, hit)
+					},
+				},
+				{
+					Map: map[string]any{"headers": map[string]any{"X-Client-Version": "3.2"}},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.Error(t, err)
+						assert.False(t, hit)
+					},
+				},
+			},
+		},
+		"quantifiers": {
+			Config: `
+policies:
+  - value: admin
+    conditions:
+      - type: any
+        spec:
+          key: "user.groups"
+          condition:
+            type: equal
+            spec:
+              key: "$"
+              value: "admin"
+  - value: readonly
+    conditions:
+      - type: and
+        spec:
+          conditions:
+            - type: all
+              spec:
+                key: "token.scopes"
+                as: "scope"
+                condition:
+                  type: glob
+                  spec:
+                    key: "scope.name"
+                    pattern: "read:*"
+                    style: host
+            - type: count
+              spec:
+                key: "token.scopes"
+                max: 2
+                condition:
+                  type: exists
+                  spec:
+                    key: "$.name"
+`,
+			ContextTests: []ContextTest{
+				{
+					Map: map[string]any{
+						"user":  map[string]any{"groups": []string{"dev", "admin"}},
+						"token": map[string]any{"scopes": []any{}},
+					},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.Equal(t, "admin", value)
+					},
+				},
+				{
+					Map: map[string]any{
+						"user": map[string]any{"groups": []any{"dev"}},
+						"token": map[string]any{"scopes": []any{
+							map[string]any{"name": "read:users"},
+							map[string]any{"name": "read:orders"},
+						}},
+					},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.Equal(t, "readonly", value)
+					},
+				},
+				{
+					Map: map[string]any{
+						"user": map[string]any{"groups": []any{"dev"}},
+						"token": map[string]any{"scopes": []any{
+							map[string]any{"name": "read:users"},
+							map[string]any{"name": "write:users"},
+						}},
+					},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.False(t, hit)
+					},
+				},
+				{
+					Map: map[string]any{"user": map[string]any{"groups": "admin"}},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.Error(t, err)
+					},
+				},
+			},
+		},
+		"shape": {
+			Config: `
+policies:
+  - value: valid
+    conditions:
+      - type: and
+        spec:
+          conditions:
+            - type: type
+              spec:
+                key: "user.id"
+                type: string
+            - type: length
+              spec:
+                key: "headers.Authorization"
+                min: 1
+            - type: length
+              spec:
+                key: "body.items"
+                max: 2
+`,
+			ContextTests: []ContextTest{
+				{
+					Map: map[string]any{
+						"user":    map[string]any{"id": "u1"},
+						"headers": map[string]any{"Authorization": "Bearer x"},
+						"body":    map[string]any{"items": []int{1, 2}},
+					},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.Equal(t, "valid", value)
+					},
+				},
+				{
+					Map: map[string]any{
+						"user":    map[string]any{"id": 1},
+						"headers": map[string]any{"Authorization": "Bearer x"},
+						"body":    map[string]any{"items": []int{1, 2}},
+					},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.False(t, hit)
+					},
+				},
+				{
+					Map: map[string]any{
+						"user":    map[string]any{"id": "u1"},
+						"headers": map[string]any{"Authorization": ""},
+						"body":    map[string]any{"items": []int{1, 2}},
+					},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.False(t, hit)
+					},
+				},
+				{
+					Map: map[string]any{
+						"user":    map[string]any{"id": "u1"},
+						"headers": map[string]any{"Authorization": "Bearer x"},
+						"body":    map[string]any{"items": map[string]any{"a": 1, "b": 2, "c": 3}},
+					},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.False(t, hit)
+					},
+				},
+			},
+		},
+		"equal_normalization": {
+			Config: `
+policies:
+  - value: port
+    conditions:
+      - type: equal
+        spec:
+          key: "port"
+          value: 8080
+  - value: flags
+    conditions:
+      - type: equal
+        spec:
+          key: "flags"
+          coerce: true
+          caseInsensitive: true
+          value:
+            debug: true
+            level: 2
+            tags: ["A", "b"]
+`,
+			ContextTests: []ContextTest{
+				{
+					Map: map[string]any{"port": json.Number("8080")},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.Equal(t, "port", value)
+					},
+				},
+				{
+					Map: map[string]any{"port": float64(8080)},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.Equal(t, "port", value)
+					},
+				},
+				{
+					Map: map[string]any{
+						"port":  "8080",
+						"flags": map[string]any{"debug": "true", "level": int64(2), "tags": []string{"a", "B"}},
+					},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.Equal(t, "flags", value)
+					},
+				},
+				{
+					Map: map[string]any{
+						"port":  8081,
+						"flags": map[string]any{"debug": "true", "level": 2.5, "tags": []string{"a", "B"}},
+					},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.False(t, hit)
+					},
+				},
+			},
+		},
+		"jsonschema": {
+			Config: `
+policies:
+  - value: order
+    conditions:
+      - type: jsonschema
+        spec:
+          key: "body"
+          schema:
+            type: object
+            required: ["id", "items"]
+            additionalProperties: false
+            properties:
+              id:
+                type: string
+                pattern: "^ord_[a-z0-9]+$"
+              priority:
+                enum: ["low", "high"]
+              total:
+                type: number
+                minimum: 10
+                multipleOf: 0.1
+              items:
+                type: array
+                minItems: 1
+                maxItems: 100
+                items:
+                  type: object
+                  required: ["sku"]
+                  properties:
+                    sku: {type: string}
+                    quantity: {type: integer, minimum: 1}
+`,
+			ContextTests: []ContextTest{
+				{
+					Map: map[string]any{"body": map[string]any{
+						"id":    "ord_42",
+						"items": []any{map[string]any{"sku": "a", "quantity": float64(2)}},
+					}},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.Equal(t, "order", value)
+					},
+				},
+				{
+					Map: map[string]any{"body": map[string]any{
+						"id":    "ord_42",
+						"items": []any{map[string]any{"sku": "a", "quantity": 1.5}},
+					}},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.False(t, hit)
+					},
+				},
+				{
+					Map: map[string]any{"body": map[string]any{
+						"id":       "ord_42",
+						"priority": "urgent",
+						"items":    []any{map[string]any{"sku": "a"}},
+					}},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.False(t, hit)
+					},
+				},
+				{
+					Map: map[string]any{"body": map[string]any{
+						"id":    "ord_42",
+						"total": 10.3,
+						"items": []any{map[string]any{"sku": "a"}},
+					}},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.Equal(t, "order", value)
+					},
+				},
+				{
+					Map: map[string]any{"body": map[string]any{
+						"id":    "ord_42",
+						"total": json.Number("10.3"),
+						"items": []any{map[string]any{"sku": "a"}},
+					}},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.Equal(t, "order", value)
+					},
+				},
+				{
+					Map: map[string]any{"body": map[string]any{
+						"id":    "ord_42",
+						"total": json.Number("5"),
+						"items": []any{map[string]any{"sku": "a"}},
+					}},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.False(t, hit)
+					},
+				},
+				{
+					Map: map[string]any{"body": map[string]any{
+						"id":    "ord_42",
+						"total": 10.35,
+						"items": []any{map[string]any{"sku": "a"}},
+					}},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.False(t, hit)
+					},
+				},
+				{
+					Map: map[string]any{"body": map[string]any{
+						"id":    "ord_42",
+						"extra": true,
+						"items": []any{map[string]any{"sku": "a"}},
+					}},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.NoError(t, err)
+						assert.False(t, hit)
+					},
+				},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := struct {
+				Policies *policyauthor.PolicyEngine `yaml:"policies"`
+			}{
+				Policies: &policyauthor.PolicyEngine{},
+			}
+
+			err := yaml.Unmarshal([]byte(test.Config), &p)
+			require.NoError(t, err)
+
+			for ctxIdx, ctxTest := range test.ContextTests {
+				value, hit, err := p.Policies.Evaluate(ctxTest.Map)
+				ctxTest.TestFunc(t, ctxIdx, value, hit, err)
+			}
+		})
+	}
+}
+
+func TestNewNumber(t *testing.T) {
+	lower, err := conditions.NewNumber(10)
+	require.NoError(t, err)
+	upper, err := conditions.NewNumber(json.Number("10.5"))
+	require.NoError(t, err)
+	_, err = conditions.NewNumber("ten")
+	assert.Error(t, err)
+
+	spec := &conditions.RangeSpec{Key: "age", Lower: &lower, LessThan: &upper}
+	assert.Equal(t, "[age] >= 10 AND < 10.5", spec.String())
+	for val, expected := range map[any]bool{9: false, 10: true, 10.4: true, uint64(11): false} {
+		hit, err := spec.Evaluate(map[string]any{"age": val})
+		require.NoError(t, err)
+		assert.Equal(t, expected, hit, val)
+	}
+}
+
+func TestEdgeCases(t *testing.T) {
+	policyauthor.RegisterConditions(conditions.AllConditionsMap())
+
+	var edgeCaseTests = map[string]TestConfig{
+		"empty_map": {
+			Config: `
+policies:
+- value: empty_test
+  conditions:
+  - type: equal
+    spec:
+      key: "nonexistent"
+      value: "none"
+`,
+			ContextTests: []ContextTest{
+				{
+					Map: map[string]any{},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {
+						assert.Error(t, err)
+						assert.False(t, hit)
+						assert.Nil(t, value)
+					},
+				},
+			},
+		},
+		"malformed_config": {
+			Config: `
+policies:
+ - value:`,
+			ContextTests: []ContextTest{
+				{
+					Map:      map[string]any{"remote_addr": "foo"},
+					TestFunc: func(t *testing.T, idx int, value any, hit bool, err error) {},
+				},
+			},
+		},
+	}
+
+	for name, test := range edgeCaseTests {
+		t.Run(name, func(t *testing.T) {
+			p := struct {
+				Policies *policyauthor.PolicyEngine `yaml:"policies"`
+			}{
+				Policies: &policyauthor.PolicyEngine{},
+			}
+
+			err := yaml.Unmarshal([]byte(test.Config), &p)
+			if name == "malformed_config" {
+				require.Error(t, err)
+				return
+			} else {
+				require.NoError(t, err)
+			}
+
+			for ctxIdx, ctxTest := range test.ContextTests {
+				value, hit, err := p.Policies.Evaluate(ctxTest.Map)
+				ctxTest.TestFunc(t, ctxIdx, value, hit, err)
+			}
+		})
+	}
+
+	// Quantifiers without a nested condition fail to load rather than to evaluate.
+	for _, typ := range []string{"any", "all", "none", "count"} {
+		conf := `
+- value: quantifier
+  conditions:
+  - type: ` + typ + `
+    spec:
+      key: "items"
+      min: 1
+`
+		err := yaml.Unmarshal([]byte(conf), &policyauthor.PolicyEngine{})
+		assert.ErrorContains(t, err, "Spec error: condition must be set", typ)
+	}
+}
+
+func TestClock(t *testing.T) {
+	policyauthor.RegisterConditions(conditions.AllConditionsMap())
+
+	conf := `
+policies:
+- value: recent
+  conditions:
+  - type: time
+    spec:
+      key: "created_at"
+      after: "now-24h"
+- value: scheduled
+  conditions:
+  - type: time
+    spec:
+      key: "created_at"
+      layout: "2006-01-02 15:04"
+      timezone: "America/New_York"
+      after: "2024-03-01 09:00"
+      before: "now+7d"
+`
+
+	p := struct {
+		Policies *policyauthor.PolicyEngine `yaml:"policies"`
+	}{
+		Policies: &policyauthor.PolicyEngine{},
+	}
+
+	err := yaml.Unmarshal([]byte(conf), &p)
+	require.NoError(t, err)
+
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	p.Policies.SetClock(policyauthor.ClockFunc(func() time.Time { return now }))
+
+	value, hit, err := p.Policies.Evaluate(map[string]any{"created_at": now.Add(-time.Hour)})
+	assert.NoError(t, err)
+	assert.True(t, hit)
+	assert.Equal(t, "recent", value)
+
+	value, hit, err = p.Policies.Evaluate(map[string]any{"created_at": now.Add(-48 * time.Hour).Unix()})
+	assert.NoError(t, err)
+	assert.True(t, hit)
+	assert.Equal(t, "scheduled", value)
+
+	// 13:30 UTC is 08:30 in New York, before the lower bound.
+	value, hit, err = p.Policies.Evaluate(map[string]any{"created_at": time.Date(2024, 3, 1, 13, 30, 0, 0, time.UTC)})
+	assert.NoError(t, err)
+	assert.False(t, hit)
+	assert.Nil(t, value)
+
+	value, hit, err = p.Policies.Evaluate(map[string]any{"created_at": time.Date(2024, 3, 1, 14, 30, 0, 0, time.UTC)})
+	assert.NoError(t, err)
+	assert.True(t, hit)
+	assert.Equal(t, "scheduled", value)
+
+	now = now.AddDate(0, 0, 30)
+	value, hit, err = p.Policies.Evaluate(map[string]any{"created_at": now.Add(-48 * time.Hour)})
+	assert.NoError(t, err)
+	assert.True(t, hit)
+	assert.Equal(t, "scheduled", value)
+
+	value, hit, err = p.Policies.Evaluate(map[string]any{"created_at": time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)})
+	assert.NoError(t, err)
+	assert.False(t, hit)
+	assert.Nil(t, value)
+}
+
+func TestSchedule(t *testing.T) {
+	policyauthor.RegisterConditions(conditions.AllConditionsMap())
+
+	holidays := filepath.Join(t.TempDir(), "holidays.txt")
+	require.NoError(t, os.WriteFile(holidays, []byte("# company holidays\n2024-12-25\n"), 0o644))
+
+	conf := `
+policies:
+- value: business-hours
+  conditions:
+  - type: schedule
+    spec:
+      timezone: "America/New_York"
+      excludeFrom: "` + holidays + `"
+      windows:
+      - days: ["mon-fri"]
+        start: "09:00"
+        end: "17:00"
+- value: nightly
+  conditions:
+  - type: schedule
+    spec:
+      key: "ts"
+      cron: ["*/15 22-23,0-5 * * *"]
+`
+
+	p := struct {
+		Policies *policyauthor.PolicyEngine `yaml:"policies"`
+	}{
+		Policies: &policyauthor.PolicyEngine{},
+	}
+
+	err := yaml.Unmarshal([]byte(conf), &p)
+	require.NoError(t, err)
+
+	var now time.Time
+	p.Policies.SetClock(policyauthor.ClockFunc(func() time.Time { return now }))
+
+	var tests = []struct {
+		now   time.Time
+		ts    time.Time
+		value any
+	}{
+		// Tuesday 10:00 in New York.
+		{now: time.Date(2024, 12, 24, 15, 0, 0, 0, time.UTC), value: "business-hours"},
+		// Holiday.
+		{now: time.Date(2024, 12, 25, 15, 0, 0, 0, time.UTC)},
+		// Saturday.
+		{now: time.Date(2024, 12, 28, 15, 0, 0, 0, time.UTC)},
+		{now: time.Date(2024, 12, 28, 15, 0, 0, 0, time.UTC), ts: time.Date(2024, 12, 28, 23, 30, 0, 0, time.UTC), value: "nightly"},
+		{now: time.Date(2024, 12, 28, 15, 0, 0, 0, time.UTC), ts: time.Date(2024, 12, 28, 23, 31, 0, 0, time.UTC)},
+	}
+
+	for idx, test := range tests {
+		now = test.now
+		if test.ts.IsZero() {
+			test.ts = now
+		}
+		value, hit, err := p.Policies.Evaluate(map[string]any{"ts": test.ts})
+		assert.NoError(t, err, idx)
+		assert.Equal(t, test.value != nil, hit, idx)
+		assert.Equal(t, test.value, value, idx)
+	}
+}
+
+func TestRollout(t *testing.T) {
+	policyauthor.RegisterConditions(conditions.AllConditionsMap())
+
+	conf := `
+policies:
+- value: canary
+  conditions:
+  - type: rollout
+    spec:
+      key: "user.id"
+      salt: "new-checkout"
+      percentage: 10
+`
+
+	p := struct {
+		Policies *policyauthor.PolicyEngine `yaml:"policies"`
+	}{
+		Policies: &policyauthor.PolicyEngine{},
+	}
+
+	err := yaml.Unmarshal([]byte(conf), &p)
+	require.NoError(t, err)
+
+	hits := 0
+	for i := 0; i < 10000; i++ {
+		ctx := map[string]any{"user": map[string]any{"id": i}}
+
+		_, hit, err := p.Policies.Evaluate(ctx)
+		require.NoError(t, err)
+		if hit {
+			hits++
+		}
+
+		// The same user always lands in the same cohort, whatever the type of its id.
+		_, again, err := p.Policies.Evaluate(map[string]any{"user": map[string]any{"id": float64(i)}})
+		require.NoError(t, err)
+		require.Equal(t, hit, again)
+	}
+	assert.InDelta(t, 1000, hits, 100)
+}
+
+func TestWeightedValues(t *testing.T) {
+	policyauthor.RegisterConditions(conditions.AllConditionsMap())
+
+	conf := `
+policies:
+- values:
+  - value: "https://stable"
+    weight: 90
+  - value: "https://canary"
+    weight: 10
+  stickyBy: ["user.id"]
+  salt: "checkout"
+  conditions:
+  - type: exists
+    spec:
+      key: "user.id"
+- values:
+  - value: "a"
+    weight: 1
+  - value: "b"
+    weight: 3
+  conditions:
+  - type: exists
+    spec:
+      key: "anonymous"
+`
+
+	p := struct {
+		Policies *policyauthor.PolicyEngine `yaml:"policies"`
+	}{
+		Policies: &policyauthor.PolicyEngine{},
+	}
+
+	err := yaml.Unmarshal([]byte(conf), &p)
+	require.NoError(t, err)
+
+	counts := map[any]int{}
+	for i := 0; i < 10000; i++ {
+		ctx := map[string]any{"user": map[string]any{"id": fmt.Sprintf("user-%d", i)}}
+
+		value, hit, err := p.Policies.Evaluate(ctx)
+		require.NoError(t, err)
+		require.True(t, hit)
+		counts[value]++
+
+		again, _, _ := p.Policies.Evaluate(ctx)
+		require.Equal(t, value, again)
+	}
+	assert.InDelta(t, 9000, counts["https://stable"], 300)
+	assert.InDelta(t, 1000, counts["https://canary"], 300)
+
+	var r float64
+	p.Policies.SetRand(policyauthor.RandFunc(func() float64 { return r }))
+	for _, test := range []struct {
+		r    float64
+		want string
+	}{{0, "a"}, {0.24, "a"}, {0.25, "b"}, {0.99, "b"}} {
+		r = test.r
+		value, hit, err := p.Policies.Evaluate(map[string]any{"anonymous": true})
+		assert.NoError(t, err)
+		assert.True(t, hit)
+		assert.Equal(t, test.want, value)
+	}
+
+	invalid := `
+policies:
+- values:
+  - value: "a"
+    weight: 0
+  conditions:
+  - type: exists
+    spec:
+      key: "anonymous"
+`
+	err = yaml.Unmarshal([]byte(invalid), &p)
+	assert.Error(t, err)
+}
+
+func TestRateLimit(t *testing.T) {
+	policyauthor.RegisterConditions(conditions.AllConditionsMap())
+
+	conf := `
+policies:
+- value: throttled
+  conditions:
+  - type: ratelimit
+    spec:
+      name: "TestRateLimit"
+      key: "remote_addr"
+      limit: 2
+      window: "1m"
+- value: backend
+  conditions:
+  - type: exists
+    spec:
+      key: "remote_addr"
+`
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	load := func() *policyauthor.PolicyEngine {
+		p := struct {
+			Policies *policyauthor.PolicyEngine `yaml:"policies"`
+		}{
+			Policies: &policyauthor.PolicyEngine{},
+		}
+		p.Policies.SetClock(policyauthor.ClockFunc(func() time.Time { return now }))
+
+		err := yaml.Unmarshal([]byte(conf), &p)
+		require.NoError(t, err)
+		return p.Policies
+	}
+
+	engine := load()
+	evaluate := func(addr string) any {
+		value, _, err := engine.Evaluate(map[string]any{"remote_addr": addr})
+		require.NoError(t, err)
+		return value
+	}
+
+	assert.Equal(t, "backend", evaluate("10.0.0.1"))
+	assert.Equal(t, "backend", evaluate("10.0.0.1"))
+	assert.Equal(t, "throttled", evaluate("10.0.0.1"))
+	assert.Equal(t, "backend", evaluate("10.0.0.2"))
+
+	// Other engines keep their own state.
+	other := load()
+	value, _, err := other.Evaluate(map[string]any{"remote_addr": "10.0.0.1"})
+	require.NoError(t, err)
+	assert.Equal(t, "backend", value)
+
+	// Reloading an unchanged definition keeps the state when it is handed over.
+	reloaded := load()
+	reloaded.InheritState(engine)
+	engine = reloaded
+	assert.Equal(t, "throttled", evaluate("10.0.0.1"))
+
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, "backend", evaluate("10.0.0.1"))
+	assert.Equal(t, "throttled", evaluate("10.0.0.1"))
+}
+
+func TestCache(t *testing.T) {
+	policyauthor.RegisterConditions(conditions.AllConditionsMap())
+
+	conf := `
+policies:
+- value: admin
+  conditions:
+  - type: equal
+    spec:
+      key: "user.role"
+      value: "admin"
+- value: internal
+  conditions:
+  - type: cidr
+    spec:
+      key: "remote_addr"
+      value: "10.0.0.0/8"
+- value: throttled
+  conditions:
+  - type: ratelimit
+    spec:
+      name: "TestCache"
+      key: "remote_addr"
+      limit: 1
+      window: "1m"
+- value: default
+  conditions:
+  - type: exists
+    spec:
+      key: "remote_addr"
+`
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := struct {
+		Policies *policyauthor.PolicyEngine `yaml:"policies"`
+	}{
+		Policies: &policyauthor.PolicyEngine{},
+	}
+	p.Policies.SetClock(policyauthor.ClockFunc(func() time.Time { return now }))
+	p.Policies.EnableCache(2, time.Minute)
+
+	err := yaml.Unmarshal([]byte(conf), &p)
+	require.NoError(t, err)
+
+	evaluate := func(role, addr string) any {
+		value, _, err := p.Policies.Evaluate(map[string]any{
+			"user":        map[string]any{"role": role},
+			"remote_addr": addr,
+		})
+		require.NoError(t, err)
+		return value
+	}
+
+	stats, ok := p.Policies.CacheStats()
+	require.True(t, ok)
+	assert.Equal(t, 2, stats.CacheablePolicies)
+	assert.Equal(t, []string{"remote_addr", "user.role"}, stats.Keys)
+
+	assert.Equal(t, "admin", evaluate("admin", "192.168.0.1"))
+	assert.Equal(t, "admin", evaluate("admin", "192.168.0.1"))
+	assert.Equal(t, "internal", evaluate("user", "10.0.0.1"))
+
+	// Cached misses still reach the policies after the cacheable ones.
+	assert.Equal(t, "default", evaluate("user", "192.168.0.2"))
+	assert.Equal(t, "throttled", evaluate("user", "192.168.0.2"))
+
+	stats, _ = p.Policies.CacheStats()
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(3), stats.Misses)
+	assert.Equal(t, 2, stats.Entries)
+
+	// The least recently used decision was evicted.
+	assert.Equal(t, "admin", evaluate("admin", "192.168.0.1"))
+	stats, _ = p.Policies.CacheStats()
+	assert.Equal(t, uint64(4), stats.Misses)
+
+	now = now.Add(time.Minute)
+	assert.Equal(t, "admin", evaluate("admin", "192.168.0.1"))
+	stats, _ = p.Policies.CacheStats()
+	assert.Equal(t, uint64(5), stats.Misses)
+
+	p.Policies.DisableCache()
+	_, ok = p.Policies.CacheStats()
+	assert.False(t, ok)
+
+	conf = `
+- valueFrom: "user.name"
+  conditions:
+  - type: exists
+    spec:
+      key: "named"
+- value:
+    tags: ["a"]
+  conditions:
+  - type: exists
+    spec:
+      key: "tagged"
+`
+	engine := &policyauthor.PolicyEngine{}
+	require.NoError(t, yaml.Unmarshal([]byte(conf), engine))
+	engine.EnableCache(10, 0)
+
+	// valueFrom reads a top-level key, even with dots in its name.
+	for _, name := range []string{"alice", "bob"} {
+		value, _, err := engine.Evaluate(map[string]any{"named": true, "user.name": name})
+		require.NoError(t, err)
+		assert.Equal(t, name, value)
+	}
+
+	// Cached values are not modified through the values returned.
+	for i := 0; i < 2; i++ {
+		value, _, err := engine.Evaluate(map[string]any{"tagged": true})
+		require.NoError(t, err)
+		tags := value.(map[string]any)["tags"].([]any)
+		assert.Equal(t, []any{"a"}, tags)
+		tags[0] = "b"
+	}
+}
+
+func TestShadowEngine(t *testing.T) {
+	policyauthor.RegisterConditions(conditions.AllConditionsMap())
+
+	load := func(conf string) *policyauthor.PolicyEngine {
+		p := struct {
+			Policies *policyauthor.PolicyEngine `yaml:"policies"`
+		}{}
+		err := yaml.Unmarshal([]byte(conf), &p)
+		require.NoError(t, err)
+		return p.Policies
+	}
+
+	active := load(`
+policies:
+- value: internal
+  conditions:
+  - type: cidr
+    spec:
+      key: "remote_addr"
+      value: "10.0.0.0/8"
+`)
+	candidate := load(`
+policies:
+- name: beta
+  value: beta
+  conditions:
+  - type: equal
+    spec:
+      key: "user.beta"
+      value: true
+- value: internal
+  conditions:
+  - type: cidr
+    spec:
+      key: "remote_addr"
+      value: "10.0.0.0/8"
+`)
+
+	var notified atomic.Int32
+	shadow := policyauthor.NewShadowEngine(active, candidate, policyauthor.ShadowOptions{
+		MaxDisagreements: 1,
+		OnDisagreement:   func(d *policyauthor.Disagreement) { notified.Add(1) },
+	})
+
+	for _, ctx := range []map[string]any{
+		{"remote_addr": "10.0.0.1", "user": map[string]any{"beta": false}},
+		{"remote_addr": "10.0.0.2", "user": map[string]any{"beta": true}},
+		{"remote_addr": "192.168.0.1", "user": map[string]any{"beta": true}},
+		{"remote_addr": "192.168.0.2", "user": map[string]any{"beta": false}},
+	} {
+		value, _, err := shadow.Evaluate(ctx)
+		require.NoError(t, err)
+		assert.NotEqual(t, "beta", value)
+	}
+	shadow.Close()
+
+	_, _, err := shadow.Evaluate(map[string]any{"remote_addr": "10.0.0.1"})
+	require.NoError(t, err)
+
+	stats := shadow.Stats()
+	assert.Equal(t, uint64(5), stats.Evaluations)
+	assert.Equal(t, uint64(4), stats.Compared)
+	assert.Equal(t, uint64(2), stats.Agreements)
+	assert.Equal(t, uint64(2), stats.Disagreements)
+	assert.Equal(t, uint64(1), stats.Dropped)
+	assert.Equal(t, 0.5, stats.AgreementRate())
+	assert.Equal(t, int32(2), notified.Load())
+
+	disagreements := shadow.Disagreements()
+	require.Len(t, disagreements, 1)
+	d := disagreements[0]
+	assert.False(t, d.Active.Hit)
+	assert.Equal(t, -1, d.Active.PolicyIndex)
+	assert.Equal(t, "beta", d.Candidate.Policy)
+	assert.Equal(t, "beta", d.Candidate.Value)
+	assert.Equal(t, map[string]any{"remote_addr": "192.168.0.1", "user.beta": true}, d.Context)
+
+	// The candidate does not take tokens from the rate limits of the active engine, even when it inherited them.
+	conf := `
+policies:
+- value: throttled
+  conditions:
+  - type: ratelimit
+    spec:
+      key: "remote_addr"
+      limit: 2
+      window: "1h"
+- value: backend
+  conditions:
+  - type: exists
+    spec:
+      key: "remote_addr"
+`
+	active = load(conf)
+	candidate = load(conf)
+	candidate.InheritState(active)
+	shadow = policyauthor.NewShadowEngine(active, candidate, policyauthor.ShadowOptions{})
+	defer shadow.Close()
+
+	ctx := map[string]any{"remote_addr": "10.0.0.1"}
+	var got []any
+	for i := 0; i < 3; i++ {
+		value, _, err := shadow.Evaluate(ctx)
+		require.NoError(t, err)
+		got = append(got, value)
+		require.Eventually(t, func() bool { return shadow.Stats().Compared == uint64(i+1) }, time.Second, time.Millisecond)
+	}
+	assert.Equal(t, []any{"backend", "backend", "throttled"}, got)
+	assert.Equal(t, uint64(3), shadow.Stats().Agreements)
+}
+
+func TestCoverage(t *testing.T) {
+	policyauthor.RegisterConditions(conditions.AllConditionsMap())
+
+	conf := `- name: admin
+  value: admin
+  conditions:
+  - type: and
+    spec:
+      conditions:
+      - type: equal
+        spec:
+          key: "role"
+          value: "admin"
+      - type: not
+        spec:
+          condition:
+            type: exists
+            spec:
+              key: "banned"
+- value: internal
+  conditions:
+  - type: or
+    spec:
+      conditions:
+      - type: cidr
+        spec:
+          key: "remote_addr"
+          value: "10.0.0.0/8"
+      - type: equal
+        spec:
+          key: "network"
+          value: "internal"
+`
+
+	engine := &policyauthor.PolicyEngine{}
+	require.NoError(t, yaml.Unmarshal([]byte(conf), engine))
+	engine.EnableCache(10, 0)
+	assert.Nil(t, engine.Coverage())
+	engine.EnableCoverage()
+
+	for _, ctx := range []map[string]any{
+		{"role": "admin"},
+		{"role": "admin"},
+		{"role": "admin", "banned": true, "remote_addr": "10.0.0.1"},
+		{"role": "user"},
+	} {
+		engine.Evaluate(ctx)
+	}
+
+	report := engine.Coverage()
+	require.Len(t, report.Policies, 2)
+
+	admin := report.Policies[0]
+	assert.Equal(t, "admin", admin.Name)
+	assert.Equal(t, 1, admin.Line)
+	// Cached decisions are not used while coverage is enabled.
+	assert.Equal(t, policyauthor.CoverageCounts{True: 2, False: 2}, admin.CoverageCounts)
+
+	and := admin.Conditions[0]
+	assert.Equal(t, 4, and.Line)
+	assert.Equal(t, policyauthor.CoverageCounts{True: 2, False: 2}, and.CoverageCounts)
+	assert.Equal(t, policyauthor.CoverageCounts{True: 3, False: 1}, and.Children[0].CoverageCounts)
+	not := and.Children[1]
+	assert.Equal(t, policyauthor.CoverageCounts{True: 2, False: 1}, not.CoverageCounts)
+	assert.Equal(t, "exists", not.Children[0].Type)
+	assert.Equal(t, 14, not.Children[0].Line)
+
+	or := report.Policies[1].Conditions[0]
+	assert.Equal(t, policyauthor.CoverageCounts{True: 1, Errors: 1}, or.CoverageCounts)
+	assert.Equal(t, policyauthor.CoverageCounts{True: 1, Errors: 1}, or.Children[0].CoverageCounts)
+	assert.False(t, or.Children[1].Reached())
+
+	summary := report.Summary()
+	assert.Equal(t, policyauthor.CoverageSummary{
+		Policies: 2, PoliciesHit: 2, Conditions: 7, Reached: 6, Covered: 4, Errored: 2,
+	}, summary)
+
+	var text strings.Builder
+	require.NoError(t, report.WriteText(&text))
+	assert.Contains(t, text.String(), "policy 0 \"admin\" (line 1): hit 2, miss 2, error 0\n")
+	assert.Contains(t, text.String(), "    equal (line 26): never reached -- [network] EQUALS internal\n")
+
+	var html strings.Builder
+	require.NoError(t, report.WriteHTML(&html, "policies.yaml", []byte(conf)))
+	assert.Contains(t, html.String(), `<tr class="unreached"><td class="num">26</td>`)
+	assert.Contains(t, html.String(), `<tr class="partial"><td class="num">19</td>`)
+
+	engine.DisableCoverage()
+	assert.Nil(t, engine.Coverage())
+}
+
+func TestAnalyze(t *testing.T) {
+	policyauthor.RegisterConditions(conditions.AllConditionsMap())
+
+	conf := `
+# 0: empty range.
+- value: a
+  conditions:
+  - type: range
+    spec:
+      key: "age"
+      lower: 10
+      upper: 5
+# 1: two different values on the same key.
+- value: b
+  conditions:
+  - type: and
+    spec:
+      conditions:
+      - type: equal
+        spec:
+          key: "role"
+          value: "admin"
+      - type: equal
+        spec:
+          key: "role"
+          value: "user"
+# 2: a key that must not exist is read, the second condition is fine.
+- value: c
+  conditions:
+  - type: and
+    spec:
+      conditions:
+      - type: not
+        spec:
+          condition:
+            type: exists
+            spec:
+              key: "user"
+      - type: equal
+        spec:
+          key: "user.role"
+          value: "admin"
+  - type: in
+    spec:
+      key: "tier"
+      values: ["gold", "silver"]
+# 3: shadowed by 2.
+- value: d
+  conditions:
+  - type: and
+    spec:
+      conditions:
+      - type: equal
+        spec:
+          key: "tier"
+          value: "gold"
+      - type: exists
+        spec:
+          key: "region"
+# 4: overlaps 2 without being subsumed.
+- value: e
+  conditions:
+  - type: in
+    spec:
+      key: "tier"
+      values: ["gold", "bronze"]
+# 5: shadowed by 2 and 4 together.
+- value: f
+  conditions:
+  - type: or
+    spec:
+      conditions:
+      - type: equal
+        spec:
+          key: "tier"
+          value: "silver"
+      - type: equal
+        spec:
+          key: "tier"
+          value: "bronze"
+# 6: narrower range, not shadowed by anything earlier.
+- value: g
+  conditions:
+  - type: range
+    spec:
+      key: "score"
+      gt: 10
+      lt: 20
+# 7: shadowed by 6.
+- value: h
+  conditions:
+  - type: and
+    spec:
+      conditions:
+      - type: range
+        spec:
+          key: "score"
+          lower: 12
+          upper: 15
+      - type: regex
+        spec:
+          key: "path"
+          pattern: "^/api"
+# 8: matching value outside of the range.
+- value: i
+  conditions:
+  - type: and
+    spec:
+      conditions:
+      - type: equal
+        spec:
+          key: "score"
+          value: 30
+      - type: range
+        spec:
+          key: "score"
+          upper: 20
+# 9 and 10: identical rate limits take different tokens, 10 matches when 9 does not.
+- value: first
+  conditions:
+  - type: ratelimit
+    spec:
+      key: "client"
+      limit: 1
+      window: "1h"
+- value: second
+  conditions:
+  - type: ratelimit
+    spec:
+      key: "client"
+      limit: 1
+      window: "1h"
+`
+
+	engine := &policyauthor.PolicyEngine{}
+	require.NoError(t, yaml.Unmarshal([]byte(conf), engine))
+
+	var got []string
+	for _, w := range conditions.Analyze(engine) {
+		got = append(got, w.String())
+	}
+	assert.Equal(t, []string{
+		"policy 0 can never match: range [age] >= 10 AND <= 5 is empty",
+		"policy 1 can never match: [role] EQUALS admin contradicts [role] EQUALS user",
+		"condition 0 of policy 2 can never match: key user must not exist but is read by [user.role] EQUALS admin",
+		"policy 3 is shadowed by policy 2",
+		"policy 5 is shadowed by policies 2, 4",
+		"policy 7 is shadowed by policy 6",
+		"policy 8 can never match: [score] EQUALS 30 contradicts [score] <= 20",
+	}, got)
+
+	value, _, err := engine.Evaluate(map[string]any{
+		"age": 0, "role": "guest", "user": map[string]any{}, "tier": "none", "score": 0, "client": "c1",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "second", value)
+}
+
+func TestOptimize(t *testing.T) {
+	policyauthor.RegisterConditions(conditions.AllConditionsMap())
+
+	conf := `
+- value: a
+  conditions:
+  - type: and
+    spec:
+      conditions:
+      - type: regex
+        spec:
+          key: "path"
+          pattern: "^/api/"
+      - type: and
+        spec:
+          conditions:
+          - type: contains
+            spec:
+              key: "path"
+              value: "/v1/"
+          - type: exists
+            spec:
+              key: "user"
+      - type: not
+        spec:
+          condition:
+            type: not
+            spec:
+              condition:
+                type: exists
+                spec:
+                  key: "user"
+- value: b
+  conditions:
+  - type: or
+    spec:
+      conditions:
+      - type: equal
+        spec:
+          key: "role"
+          value: "admin"
+      - type: or
+        spec:
+          conditions:
+          - type: equal
+            spec:
+              key: "role"
+              value: "owner"
+          - type: equal
+            spec:
+              key: "role"
+              value: "admin"
+      - type: equal
+        spec:
+          key: "role"
+          value: "editor"
+          caseInsensitive: true
+- value: c
+  conditions:
+  - type: and
+    spec:
+      conditions:
+      - type: exists
+        spec:
+          key: "tenant"
+      - type: regex
+        spec:
+          key: "tenant"
+          pattern: "^t-(.+)$"
+          return: \1
+      - type: and
+        spec:
+          conditions:
+          - type: exists
+            spec:
+              key: "tenant"
+`
+
+	original := &policyauthor.PolicyEngine{}
+	require.NoError(t, yaml.Unmarshal([]byte(conf), original))
+	optimized := &policyauthor.PolicyEngine{}
+	require.NoError(t, yaml.Unmarshal([]byte(conf), optimized))
+
+	stats := conditions.Optimize(optimized)
+	assert.Equal(t, conditions.OptimizeStats{
+		Flattened:       3,
+		Deduplicated:    1,
+		NegationsFolded: 1,
+		SetLookups:      2,
+		Reordered:       1,
+	}, stats)
+
+	var got [][]string
+	for _, p := range optimized.Policies() {
+		var cs []string
+		for _, c := range p.Conditions {
+			cs = append(cs, c.String())
+		}
+		got = append(got, cs)
+	}
+	assert.Equal(t, [][]string{
+		// The contains condition fails on the same contexts as the regex one and is cheaper,
+		// the exists condition is not moved ahead of them.
+		{"([path] SUBSTRING /v1/) AND ([path] MATCHES REGEX ^/api/) AND ([user] EXISTS)"},
+		{"[role] EQUALS ONE OF [admin, owner]", "[role] EQUALS editor"},
+		// Siblings of conditions returning values in and conditions are left as they are.
+		{"([tenant] EXISTS) AND ([tenant] MATCHES REGEX ^t-(.+)$) AND (([tenant] EXISTS))"},
+	}, got)
+
+	contexts := []map[string]any{
+		{"path": "/api/v1/users", "user": "alice"},
+		{"path": "/api/v2/users", "user": "alice"},
+		{"path": "/api/v1/users"},
+		{"path": 42, "user": "alice"},
+		{"user": "alice"},
+		{"role": "ADMIN"},
+		{"role": "owner"},
+		{"role": "Editor"},
+		{"role": []any{"admin"}},
+		{"role": 1},
+		{"tenant": "t-acme"},
+		{"tenant": "acme"},
+		{"other": true},
+	}
+	for _, ctx := range contexts {
+		wantValue, wantHit, wantErr := original.Evaluate(ctx)
+		value, hit, err := optimized.Evaluate(ctx)
+		assert.Equal(t, wantValue, value, "%v", ctx)
+		assert.Equal(t, wantHit, hit, "%v", ctx)
+		assert.Equal(t, wantErr != nil, err != nil, "%v", ctx)
+		if wantErr != nil {
+			assert.Equal(t, errors.Is(wantErr, policyauthor.ErrKeyNotFound), errors.Is(err, policyauthor.ErrKeyNotFound), "%v", ctx)
+		}
+	}
+}
+
+func TestAdaptiveOrder(t *testing.T) {
+	policyauthor.RegisterConditions(conditions.AllConditionsMap())
+
+	conf := `
+- value: a
+  conditions:
+  - type: or
+    spec:
+      adaptive: true
+      reorderEvery: 10
+      conditions:
+      - type: equal
+        spec:
+          key: "role"
+          value: "admin"
+      - type: equal
+        spec:
+          key: "tier"
+          value: "gold"
+`
+
+	engine := &policyauthor.PolicyEngine{}
+	require.NoError(t, yaml.Unmarshal([]byte(conf), engine))
+	or := engine.Policies()[0].Conditions[0].Spec.(*conditions.OrSpec)
+
+	order := func() []string {
+		var out []string
+		for _, c := range or.EvaluationOrder() {
+			out = append(out, c.String())
+		}
+		return out
+	}
+	declared := []string{"[role] EQUALS admin", "[tier] EQUALS gold"}
+	assert.Equal(t, declared, order())
+
+	ctx := map[string]any{"role": "user", "tier": "gold"}
+	for i := 0; i < 10; i++ {
+		value, hit, err := engine.Evaluate(ctx)
+		require.NoError(t, err)
+		assert.True(t, hit)
+		assert.Equal(t, "a", value)
+	}
+
+	// The tier condition ended every evaluation, the role condition none.
+	assert.Equal(t, []string{"[tier] EQUALS gold", "[role] EQUALS admin"}, order())
+	stats := or.ChildStats()
+	require.Len(t, stats, 2)
+	// The statistics are halved once reordered.
+	assert.Equal(t, uint64(5), stats[0].Misses)
+	assert.Equal(t, uint64(5), stats[1].Hits)
+
+	// The role condition is no longer reached.
+	_, _, err := engine.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), or.ChildStats()[0].Evaluations())
+	assert.Equal(t, uint64(6), or.ChildStats()[1].Hits)
+
+	or.ResetOrder()
+	assert.Equal(t, declared, order())
+	assert.Zero(t, or.ChildStats()[1].Evaluations())
+
+	conf = `
+- value: a
+  conditions:
+  - type: and
+    spec:
+      adaptive: true
+      conditions:
+      - type: regex
+        spec:
+          key: "path"
+          pattern: "^/(.+)$"
+          return: \1
+      - type: exists
+        spec:
+          key: "user"
+`
+	err = yaml.Unmarshal([]byte(conf), &policyauthor.PolicyEngine{})
+	assert.ErrorContains(t, err, "AndSpec error: condition [path] MATCHES REGEX ^/(.+)$ returns values")
+
+	// Conditions on the current time have no side effects, unlike rate limits.
+	conf = `
+- value: a
+  conditions:
+  - type: or
+    spec:
+      adaptive: true
+      conditions:
+      - type: time
+        spec:
+          key: "expires"
+          after: "now"
+      - type: %s
+        spec:
+          key: "user"
+          limit: 1
+          window: "1m"
+`
+	require.NoError(t, yaml.Unmarshal([]byte(fmt.Sprintf(conf, "exists")), &policyauthor.PolicyEngine{}))
+	err = yaml.Unmarshal([]byte(fmt.Sprintf(conf, "ratelimit")), &policyauthor.PolicyEngine{})
+	assert.ErrorContains(t, err, "OrSpec error: condition [user] EXCEEDS 1 PER 1m keeps state across evaluations")
 }
@@ -0,0 +1,249 @@
+package policyauthor
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultShadowQueueSize        = 1024
+	defaultShadowMaxDisagreements = 100
+)
+
+// ShadowOptions configure a ShadowEngine.
+type ShadowOptions struct {
+	// QueueSize is the number of evaluations waiting for the candidate engine beyond which new ones are dropped.
+	// It defaults to 1024.
+	QueueSize int
+	// Workers is the number of goroutines evaluating the candidate engine. It defaults to 1.
+	Workers int
+	// MaxDisagreements is the number of most recent disagreements kept. It defaults to 100.
+	MaxDisagreements int
+	// OnDisagreement, if set, is called from a worker goroutine for every disagreement.
+	OnDisagreement func(d *Disagreement)
+}
+
+// ShadowEngine evaluates an active engine and, in the background, a candidate engine against the same contexts,
+// recording the decisions they disagree on. Only the decisions of the active engine are returned.
+//
+// Evaluation contexts are shared with the candidate engine once Evaluate returns, and must not be modified afterwards.
+// The candidate engine keeps its own state for conditions keeping state across evaluations, such as rate limits,
+// so that evaluating it does not affect the decisions of the active engine.
+type ShadowEngine struct {
+	active, candidate *PolicyEngine
+	opts              ShadowOptions
+
+	queue chan *shadowJob
+	wg    sync.WaitGroup
+	// mu guards queue against being closed while sending.
+	mu     sync.RWMutex
+	closed bool
+
+	evaluations, compared, agreements, disagreements, dropped atomic.Uint64
+
+	recentMu sync.Mutex
+	recent   []*Disagreement
+	next     int
+}
+
+// ShadowDecision is the decision of one of the engines of a ShadowEngine.
+type ShadowDecision struct {
+	// Policy identifies the policy that hit by its name, or by its index if it has none.
+	Policy string
+	// PolicyIndex is the index of the policy that hit, or that failed when Err is set, and -1 otherwise.
+	PolicyIndex int
+	Hit         bool
+	Value       any
+	Err         error
+}
+
+// Disagreement records an evaluation context the active and candidate engines decided differently.
+type Disagreement struct {
+	Time      time.Time
+	Active    ShadowDecision
+	Candidate ShadowDecision
+	// Context holds the values of the keys of the evaluation context read by either engine to reach its decision,
+	// keyed by their path. Keys missing from the evaluation context are omitted.
+	Context map[string]any
+}
+
+// ShadowStats describes the activity of a ShadowEngine.
+type ShadowStats struct {
+	// Evaluations is the number of evaluations of the active engine.
+	Evaluations uint64
+	// Compared is the number of evaluations the candidate engine was compared on.
+	Compared      uint64
+	Agreements    uint64
+	Disagreements uint64
+	// Dropped is the number of evaluations not compared because the queue was full or the engine closed.
+	Dropped uint64
+}
+
+// AgreementRate returns the fraction of compared evaluations both engines agreed on, or 1 if none were compared.
+func (s ShadowStats) AgreementRate() float64 {
+	if s.Compared == 0 {
+		return 1
+	}
+	return float64(s.Agreements) / float64(s.Compared)
+}
+
+type shadowJob struct {
+	evaluationContext map[string]any
+	active            decision
+	activeErr         error
+}
+
+// NewShadowEngine returns a ShadowEngine and starts its workers. Close must be called to stop them.
+// The engines must be distinct. The state of the conditions of the candidate engine is reset,
+// as it may have been inherited from the active engine.
+func NewShadowEngine(active, candidate *PolicyEngine, opts ShadowOptions) *ShadowEngine {
+	candidate.ResetState()
+
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaultShadowQueueSize
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.MaxDisagreements <= 0 {
+		opts.MaxDisagreements = defaultShadowMaxDisagreements
+	}
+
+	s := &ShadowEngine{
+		active:    active,
+		candidate: candidate,
+		opts:      opts,
+		queue:     make(chan *shadowJob, opts.QueueSize),
+	}
+
+	s.wg.Add(opts.Workers)
+	for i := 0; i < opts.Workers; i++ {
+		go func() {
+			defer s.wg.Done()
+			for job := range s.queue {
+				s.compare(job)
+			}
+		}()
+	}
+
+	return s
+}
+
+// Evaluate evaluates the active engine and queues the evaluation of the candidate engine.
+func (s *ShadowEngine) Evaluate(evaluationContext map[string]any) (value any, hit bool, err error) {
+	d, err := s.active.evaluateObserved(evaluationContext)
+	s.evaluations.Add(1)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		s.dropped.Add(1)
+		return d.value, d.hit, err
+	}
+
+	select {
+	case s.queue <- &shadowJob{evaluationContext: evaluationContext, active: d, activeErr: err}:
+	default:
+		s.dropped.Add(1)
+	}
+
+	return d.value, d.hit, err
+}
+
+// Close waits for the queued evaluations to be compared and stops the workers.
+func (s *ShadowEngine) Close() {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// Stats returns the activity of the engine.
+func (s *ShadowEngine) Stats() ShadowStats {
+	return ShadowStats{
+		Evaluations:   s.evaluations.Load(),
+		Compared:      s.compared.Load(),
+		Agreements:    s.agreements.Load(),
+		Disagreements: s.disagreements.Load(),
+		Dropped:       s.dropped.Load(),
+	}
+}
+
+// Disagreements returns the most recent disagreements, oldest first.
+func (s *ShadowEngine) Disagreements() []*Disagreement {
+	s.recentMu.Lock()
+	defer s.recentMu.Unlock()
+
+	out := make([]*Disagreement, 0, len(s.recent))
+	if len(s.recent) == s.opts.MaxDisagreements {
+		out = append(out, s.recent[s.next:]...)
+		return append(out, s.recent[:s.next]...)
+	}
+	return append(out, s.recent...)
+}
+
+func (s *ShadowEngine) compare(job *shadowJob) {
+	d, err := s.candidate.evaluateObserved(job.evaluationContext)
+	s.compared.Add(1)
+
+	if decisionsAgree(job.active, job.activeErr, d, err) {
+		s.agreements.Add(1)
+		return
+	}
+	s.disagreements.Add(1)
+
+	context := s.active.dependencies(job.active, job.activeErr, job.evaluationContext)
+	for k, v := range s.candidate.dependencies(d, err, job.evaluationContext) {
+		if context == nil {
+			context = map[string]any{}
+		}
+		context[k] = v
+	}
+
+	dis := &Disagreement{
+		Time:      s.active.Clock().Now(),
+		Active:    s.active.shadowDecision(job.active, job.activeErr),
+		Candidate: s.candidate.shadowDecision(d, err),
+		Context:   context,
+	}
+
+	s.recentMu.Lock()
+	if len(s.recent) < s.opts.MaxDisagreements {
+		s.recent = append(s.recent, dis)
+	} else {
+		s.recent[s.next] = dis
+		s.next = (s.next + 1) % s.opts.MaxDisagreements
+	}
+	s.recentMu.Unlock()
+
+	if s.opts.OnDisagreement != nil {
+		s.opts.OnDisagreement(dis)
+	}
+}
+
+func (pe *PolicyEngine) shadowDecision(d decision, err error) ShadowDecision {
+	sd := ShadowDecision{PolicyIndex: d.policy, Hit: d.hit, Value: d.value, Err: err}
+	if d.hit {
+		sd.Policy = pe.policies[d.policy].label(d.policy)
+	}
+	return sd
+}
+
+// decisionsAgree reports whether two decisions are equivalent.
+// Decisions agree when both failed, or when both hit with deeply equal values, or when both missed.
+func decisionsAgree(a decision, aErr error, b decision, bErr error) bool {
+	if aErr != nil || bErr != nil {
+		return aErr != nil && bErr != nil
+	}
+	if a.hit != b.hit {
+		return false
+	}
+	return !a.hit || reflect.DeepEqual(a.value, b.value)
+}
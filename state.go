@@ -0,0 +1,40 @@
+package policyauthor
+
+// InheritState hands the state kept by the conditions of old, such as rate limit buckets,
+// over to the conditions of pe with the same definition, so that it survives reloading the engine.
+// The state of old that no condition of pe uses is dropped from pe.
+// Both engines share the state handed over, so old should no longer be evaluated.
+// It must not be called concurrently with Evaluate.
+func (pe *PolicyEngine) InheritState(old *PolicyEngine) {
+	pe.attachState(old.state)
+}
+
+// ResetState discards the state kept by the conditions of the engine. It must not be called concurrently with Evaluate.
+func (pe *PolicyEngine) ResetState() {
+	pe.attachState(nil)
+}
+
+// attachState sets the state of the Stateful conditions of the engine to the state held for them in states,
+// or to new state when states holds none, and keeps only the state in use.
+func (pe *PolicyEngine) attachState(states map[string]any) {
+	used := map[string]any{}
+	pe.walk(func(c *Condition) bool {
+		s, ok := c.Spec.(Stateful)
+		if !ok {
+			return true
+		}
+
+		key := c.Type + "\x00" + s.StateKey()
+		state, ok := used[key]
+		if !ok {
+			if state, ok = states[key]; !ok {
+				state = s.NewState()
+			}
+			used[key] = state
+		}
+		s.SetState(state)
+
+		return true
+	})
+	pe.state = used
+}
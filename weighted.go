@@ -0,0 +1,92 @@
+package policyauthor
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+
+	"github.com/raphaelreyna/policyauthor/pkg/hashutils"
+	"github.com/raphaelreyna/policyauthor/pkg/maputils"
+)
+
+// RandSource is the source of randomness for weighted value selection.
+// Implementations must be safe for concurrent use.
+type RandSource interface {
+	// Float64 returns a number in [0, 1).
+	Float64() float64
+}
+
+type RandFunc func() float64
+
+func (f RandFunc) Float64() float64 {
+	return f()
+}
+
+// SystemRand is the default RandSource, backed by math/rand/v2.
+var SystemRand RandSource = RandFunc(rand.Float64)
+
+// WeightedValue is one of the candidate values of a policy, selected with a probability proportional to its Weight.
+type WeightedValue struct {
+	Value  any     `yaml:"value"`
+	Weight float64 `yaml:"weight"`
+}
+
+func validateWeights(values []*WeightedValue) error {
+	var total float64
+	for i, v := range values {
+		if v == nil {
+			return fmt.Errorf("weighted value %d is empty", i)
+		}
+		if v.Weight < 0 || math.IsNaN(v.Weight) || math.IsInf(v.Weight, 0) {
+			return fmt.Errorf("weighted value %d has invalid weight %v", i, v.Weight)
+		}
+		total += v.Weight
+	}
+	if total <= 0 {
+		return fmt.Errorf("weighted values must have a positive total weight")
+	}
+	return nil
+}
+
+// pickWeighted selects the value whose cumulative weight range contains f, a number in [0, 1).
+func pickWeighted(values []*WeightedValue, f float64) any {
+	var total float64
+	for _, v := range values {
+		total += v.Weight
+	}
+
+	point := f * total
+	for _, v := range values {
+		if point < v.Weight {
+			return v.Value
+		}
+		point -= v.Weight
+	}
+
+	// Only reachable through floating point rounding, fall back to the last candidate with weight.
+	for i := len(values) - 1; i >= 0; i-- {
+		if values[i].Weight > 0 {
+			return values[i].Value
+		}
+	}
+	return nil
+}
+
+// stickyFraction hashes the values at keys with salt onto [0, 1).
+func stickyFraction(keys []string, salt string, evaluationContext map[string]any) (float64, error) {
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		val, found := maputils.RecursiveGet(key, evaluationContext)
+		if !found {
+			return 0, NewKeyNotFoundError(key)
+		}
+
+		str, err := hashutils.Canonical(val)
+		if err != nil {
+			return 0, fmt.Errorf("value at key %s: %s", key, err)
+		}
+		values[i] = str
+	}
+
+	return hashutils.Fraction(hashutils.Hash(salt, values...)), nil
+}